@@ -0,0 +1,259 @@
+package lbotx
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorAccountLinkDisabled = errors.New("Account link is not enabled")
+	ErrorMissingLinkToken    = errors.New("Missing link token")
+)
+
+const accountLinkEndpoint = "https://access.line.me/dialog/bot/accountLink"
+
+// NonceStore maps account link nonces to internal user ids until they expire
+type NonceStore interface {
+	Put(nonce, internalUserId string, expire time.Time) error
+	// Take returns the user id of nonce and removes it. Expired nonces are not found
+	Take(nonce string) (string, bool)
+}
+
+type nonceEntry struct {
+	internalUserId string
+	expire         time.Time
+}
+
+type memoryNonceStore struct {
+	lock   sync.Mutex
+	nonces map[string]*nonceEntry
+}
+
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]*nonceEntry)}
+}
+
+func (s *memoryNonceStore) Put(nonce, internalUserId string, expire time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for n, entry := range s.nonces {
+		if now.After(entry.expire) {
+			delete(s.nonces, n)
+		}
+	}
+
+	s.nonces[nonce] = &nonceEntry{internalUserId, expire}
+	return nil
+}
+
+func (s *memoryNonceStore) Take(nonce string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.nonces[nonce]
+	if !ok {
+		return "", false
+	}
+	delete(s.nonces, nonce)
+
+	if time.Now().After(entry.expire) {
+		return "", false
+	}
+	return entry.internalUserId, true
+}
+
+// AccountLinker links LINE users to internal accounts. Users are sent to LoginUrl with a
+// linkToken query parameter; ServeHTTP handles that url once Authenticate recognizes them.
+// It asks them to confirm with ConfirmPage and links only on the CSRF protected POST of
+// that page, so a link token from someone else's url can't be linked silently
+type AccountLinker struct {
+	LoginUrl string
+	// Authenticate returns the internal user id of the logged in user of req
+	Authenticate func(req *http.Request) (string, error)
+	Store        NonceStore
+	NonceTTL     time.Duration
+	// ConfirmPage is rendered with .LinkToken and .CSRFToken and should post both back
+	ConfirmPage *template.Template
+	// CSRFKey signs confirmation pages. Share it between instances behind a load balancer
+	CSRFKey []byte
+}
+
+var defaultConfirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html><body>
+<p>Link your LINE account to this account?</p>
+<form method="POST">
+<input type="hidden" name="linkToken" value="{{.LinkToken}}">
+<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+<button type="submit">Link</button>
+</form>
+</body></html>`))
+
+func (b *Bot) EnableAccountLink(loginUrl string, authenticate func(req *http.Request) (string, error)) *AccountLinker {
+	b.accountLinker = &AccountLinker{
+		LoginUrl:     loginUrl,
+		Authenticate: authenticate,
+		Store:        NewMemoryNonceStore(),
+		NonceTTL:     10 * time.Minute,
+		ConfirmPage:  defaultConfirmPage,
+		CSRFKey:      make([]byte, 32),
+	}
+	rand.Read(b.accountLinker.CSRFKey)
+	return b.accountLinker
+}
+
+// LinkAction issues a link token for the user of context and returns an uri action
+// opening the login page with it
+func (al *AccountLinker) LinkAction(context *BotContext, label string) (linebot.TemplateAction, error) {
+	userId := context.GetUserId()
+	if userId == "" {
+		return nil, ErrorInvalidUserId
+	}
+
+	resp, e := context.bot.IssueLinkToken(userId).Do()
+	if e != nil {
+		return nil, e
+	}
+
+	loginUrl, e := url.Parse(al.LoginUrl)
+	if e != nil {
+		return nil, e
+	}
+
+	query := loginUrl.Query()
+	query.Set("linkToken", resp.LinkToken)
+	loginUrl.RawQuery = query.Encode()
+
+	return linebot.NewURITemplateAction(label, loginUrl.String()), nil
+}
+
+func newNonce() (string, error) {
+	buf := make([]byte, 24)
+	if _, e := rand.Read(buf); e != nil {
+		return "", e
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// RedirectUrl creates a nonce for internalUserId and returns the LINE url finishing the link
+func (al *AccountLinker) RedirectUrl(linkToken, internalUserId string) (string, error) {
+	if linkToken == "" {
+		return "", ErrorMissingLinkToken
+	}
+
+	nonce, e := newNonce()
+	if e != nil {
+		return "", e
+	}
+
+	if e := al.Store.Put(nonce, internalUserId, time.Now().Add(al.NonceTTL)); e != nil {
+		return "", e
+	}
+
+	query := url.Values{}
+	query.Set("linkToken", linkToken)
+	query.Set("nonce", nonce)
+	return accountLinkEndpoint + "?" + query.Encode(), nil
+}
+
+// csrfToken binds a confirmation page to the user and link token it was shown for
+func (al *AccountLinker) csrfToken(linkToken, internalUserId string, expire time.Time) string {
+	expiry := strconv.FormatInt(expire.Unix(), 10)
+
+	mac := hmac.New(sha256.New, al.CSRFKey)
+	mac.Write([]byte(internalUserId + "\n" + linkToken + "\n" + expiry))
+	return expiry + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (al *AccountLinker) validCSRFToken(token, linkToken, internalUserId string) bool {
+	idx := strings.Index(token, ".")
+	if idx < 0 {
+		return false
+	}
+
+	expiry, e := strconv.ParseInt(token[:idx], 10, 64)
+	if e != nil || time.Now().After(time.Unix(expiry, 0)) {
+		return false
+	}
+
+	expected := al.csrfToken(linkToken, internalUserId, time.Unix(expiry, 0))
+	return hmac.Equal([]byte(token), []byte(expected))
+}
+
+// ServeHTTP shows the confirmation page on GET and redirects to LINE on its POST
+func (al *AccountLinker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	linkToken := req.URL.Query().Get("linkToken")
+	if req.Method == "POST" {
+		linkToken = req.PostFormValue("linkToken")
+	}
+	if linkToken == "" {
+		w.WriteHeader(400)
+		return
+	}
+
+	internalUserId, e := al.Authenticate(req)
+	if e != nil || internalUserId == "" {
+		w.WriteHeader(401)
+		return
+	}
+
+	if req.Method == "GET" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		al.ConfirmPage.Execute(w, map[string]string{
+			"LinkToken": linkToken,
+			"CSRFToken": al.csrfToken(linkToken, internalUserId, time.Now().Add(al.NonceTTL)),
+		})
+		return
+	}
+
+	if !al.validCSRFToken(req.PostFormValue("csrfToken"), linkToken, internalUserId) {
+		w.WriteHeader(403)
+		return
+	}
+
+	redirectUrl, e := al.RedirectUrl(linkToken, internalUserId)
+	if e != nil {
+		w.WriteHeader(500)
+		return
+	}
+
+	http.Redirect(w, req, redirectUrl, http.StatusSeeOther)
+}
+
+type AccountLinkHandler func(context *BotContext, internalUserId string, ok bool) (bool, error)
+
+// OnAccountLink handles accountLink events with the internal user id the nonce was issued
+// for. ok is false when LINE failed the link or the nonce is unknown or expired
+func (r *Router) OnAccountLink(handler AccountLinkHandler) {
+	r.OnAccountLinkEvent(func(context *BotContext, nonce string, ok bool) (bool, error) {
+		bot := r.root().bot
+		if bot == nil || bot.accountLinker == nil {
+			return false, ErrorAccountLinkDisabled
+		}
+
+		linker := bot.accountLinker
+		internalUserId, found := linker.Store.Take(nonce)
+		return handler(context, internalUserId, ok && found)
+	})
+}
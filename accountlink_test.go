@@ -0,0 +1,114 @@
+package lbotx
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountLink(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, req.URL.Path, "/v2/bot/user/u206d25c2ea6bd87c17655609a1c37cb8/linkToken")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"linkToken":"NMZTNuVrPTqlr2IF8Bnymkb7rXfYv5EY"}`))
+	}))
+	defer mockServer.Close()
+
+	client, _ := mockClient(mockServer)
+	bot, _ := NewBot("test", "test")
+	bot.Client = client
+
+	linker := bot.EnableAccountLink("https://example.com/login?from=line", func(req *http.Request) (string, error) {
+		if c, e := req.Cookie("session"); e == nil {
+			return "member-" + c.Value, nil
+		}
+		return "", errors.New("Not logged in")
+	})
+
+	event := &linebot.Event{
+		Type: linebot.EventTypeMessage,
+		Source: &linebot.EventSource{
+			Type:   linebot.EventSourceTypeUser,
+			UserID: "u206d25c2ea6bd87c17655609a1c37cb8",
+		},
+	}
+
+	action, e := linker.LinkAction(bot.NewContext(event), "Link account")
+	assert.Nil(t, e)
+	assert.Equal(t, action, linebot.NewURITemplateAction("Link account", "https://example.com/login?from=line&linkToken=NMZTNuVrPTqlr2IF8Bnymkb7rXfYv5EY"))
+
+	//Login redirect
+	req := httptest.NewRequest("GET", "/login?linkToken=NMZTNuVrPTqlr2IF8Bnymkb7rXfYv5EY", nil)
+	w := httptest.NewRecorder()
+	linker.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, 401)
+
+	//Confirmation page
+	req.AddCookie(&http.Cookie{Name: "session", Value: "42"})
+	w = httptest.NewRecorder()
+	linker.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, 200)
+	assert.Equal(t, w.Header().Get("X-Frame-Options"), "DENY")
+	matches := regexp.MustCompile(`name="csrfToken" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	assert.Equal(t, len(matches), 2)
+	csrfToken := matches[1]
+
+	post := func(session, linkToken, csrfToken string) *httptest.ResponseRecorder {
+		form := url.Values{"linkToken": {linkToken}, "csrfToken": {csrfToken}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session", Value: session})
+		w := httptest.NewRecorder()
+		linker.ServeHTTP(w, req)
+		return w
+	}
+
+	//Forged confirmations
+	assert.Equal(t, post("42", "NMZTNuVrPTqlr2IF8Bnymkb7rXfYv5EY", "").Code, 403)
+	assert.Equal(t, post("43", "NMZTNuVrPTqlr2IF8Bnymkb7rXfYv5EY", csrfToken).Code, 403)
+	assert.Equal(t, post("42", "attackerToken", csrfToken).Code, 403)
+
+	w = post("42", "NMZTNuVrPTqlr2IF8Bnymkb7rXfYv5EY", csrfToken)
+	assert.Equal(t, w.Code, http.StatusSeeOther)
+
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, location.Host, "access.line.me")
+	assert.Equal(t, location.Query().Get("linkToken"), "NMZTNuVrPTqlr2IF8Bnymkb7rXfYv5EY")
+	nonce := location.Query().Get("nonce")
+	assert.True(t, len(nonce) >= 10)
+
+	//accountLink event
+	results := []string{}
+	bot.OnAccountLink(func(context *BotContext, internalUserId string, ok bool) (bool, error) {
+		if ok {
+			results = append(results, internalUserId)
+		} else {
+			results = append(results, "failed")
+		}
+		return false, nil
+	})
+
+	event = &linebot.Event{
+		Type:        linebot.EventTypeAccountLink,
+		Source:      event.Source,
+		AccountLink: &linebot.AccountLink{Result: linebot.AccountLinkResultOK, Nonce: nonce},
+	}
+	bot.table.handlers()[0](bot.NewContext(event))
+	//A nonce can only be used once
+	bot.table.handlers()[0](bot.NewContext(event))
+
+	expired, _ := newNonce()
+	linker.Store.Put(expired, "member-43", time.Now().Add(-time.Second))
+	event.AccountLink.Nonce = expired
+	bot.table.handlers()[0](bot.NewContext(event))
+
+	assert.Equal(t, results, []string{"member-42", "failed", "failed"})
+}
@@ -0,0 +1,104 @@
+package lbotx
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+type APIErrorDetail struct {
+	Property string
+	Message  string
+}
+
+// APIError is an error response of the LINE API. RequestID is only known when the client
+// goes through Transport, which NewBot sets up unless given another http client
+type APIError struct {
+	StatusCode int
+	Message    string
+	Details    []APIErrorDetail
+	RequestID  string
+	Retryable  bool
+
+	Err error
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return e.Err.Error() + " (request id " + e.RequestID + ")"
+	}
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// wrapAPIError turns errors of the LINE API into APIError and leaves others as they are
+func wrapAPIError(e error, info *callInfo) error {
+	var apiError *linebot.APIError
+	if !errors.As(e, &apiError) {
+		return e
+	}
+
+	wrapped := &APIError{
+		StatusCode: apiError.Code,
+		Retryable:  retryableStatus(apiError.Code),
+		Err:        e,
+	}
+	if info != nil {
+		wrapped.RequestID = info.requestId
+	}
+	if apiError.Response != nil {
+		wrapped.Message = apiError.Response.Message
+		for _, d := range apiError.Response.Details {
+			wrapped.Details = append(wrapped.Details, APIErrorDetail{d.Property, d.Message})
+		}
+	}
+
+	return wrapped
+}
+
+// RequestIDTransport records X-Line-Request-Id of responses for APIError.
+//
+// Deprecated: use Transport, which sets retry keys too
+func RequestIDTransport(base http.RoundTripper) http.RoundTripper {
+	return Transport(base)
+}
+
+func AsAPIError(e error) (*APIError, bool) {
+	var apiError *APIError
+	ok := errors.As(e, &apiError)
+	return apiError, ok
+}
+
+func IsRateLimited(e error) bool {
+	apiError, ok := AsAPIError(e)
+	return ok && apiError.StatusCode == http.StatusTooManyRequests
+}
+
+func IsInvalidReplyToken(e error) bool {
+	apiError, ok := AsAPIError(e)
+	return ok && apiError.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(apiError.Message), "reply token")
+}
+
+// IsRetryable tells whether trying again later may succeed: rate limits, server errors of
+// the LINE API, network timeouts and an open circuit breaker
+func IsRetryable(e error) bool {
+	if IsCircuitOpen(e) {
+		return true
+	}
+	if apiError, ok := AsAPIError(e); ok {
+		return apiError.Retryable
+	}
+
+	var netError net.Error
+	return errors.As(e, &netError) && netError.Timeout()
+}
@@ -0,0 +1,81 @@
+package lbotx
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIError(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Line-Request-Id", "f70dd685-499a-4231-a441-f24b8d4fba21")
+		if strings.Contains(req.RequestURI, "reply") {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"message":"Invalid reply token"}`))
+		} else if strings.Contains(req.RequestURI, "push") {
+			w.WriteHeader(429)
+			w.Write([]byte(`{"message":"The API rate limit has been exceeded. Try again later."}`))
+		} else {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"message":"The request body has 1 error(s)","details":[{"message":"May not be empty","property":"messages[0].text"}]}`))
+		}
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test",
+		linebot.WithHTTPClient(&http.Client{
+			Transport: Transport(&http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}),
+		}),
+		linebot.WithEndpointBase(mockServer.URL),
+	)
+
+	errs := []error{}
+	bot.OnError(func(context *BotContext, err error) {
+		errs = append(errs, err)
+	})
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		context.Messages.AddTextMessage(text)
+		return false, nil
+	})
+
+	event := textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "hi")
+	event.ReplyToken = "nHuyWiB7yP5Zw52FIkcQobQuGDXCTA"
+	bot.handleEvent(event)
+
+	assert.Equal(t, len(errs), 1)
+	assert.True(t, IsInvalidReplyToken(errs[0]))
+	assert.False(t, IsRateLimited(errs[0]))
+	assert.False(t, IsRetryable(errs[0]))
+
+	apiError, ok := AsAPIError(errs[0])
+	assert.True(t, ok)
+	assert.Equal(t, apiError.StatusCode, 400)
+	assert.Equal(t, apiError.Message, "Invalid reply token")
+	assert.Equal(t, apiError.RequestID, "f70dd685-499a-4231-a441-f24b8d4fba21")
+
+	var lineError *linebot.APIError
+	assert.True(t, errors.As(errs[0], &lineError))
+
+	pm := bot.NewPostMan().WithRetryPolicy(NoRetry)
+	pm.AddTextMessage("hi")
+	_, e := pm.SendImmediately("U1")
+	assert.True(t, IsRateLimited(e))
+	assert.True(t, IsRetryable(e))
+
+	_, e = bot.NewContext(event).GetUser()
+	apiError, ok = AsAPIError(e)
+	assert.True(t, ok)
+	assert.Equal(t, apiError.Details, []APIErrorDetail{{"messages[0].text", "May not be empty"}})
+
+	assert.False(t, IsRetryable(errors.New("not an api error")))
+	_, ok = AsAPIError(errors.New("not an api error"))
+	assert.False(t, ok)
+}
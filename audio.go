@@ -0,0 +1,313 @@
+package lbotx
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+)
+
+var (
+	ErrorUnknownAudioFormat = errors.New("Unknown audio format")
+	ErrorInvalidAudioData   = errors.New("Invalid or truncated audio data")
+	ErrorUnsupportedAudio   = errors.New("LINE doesn't accept ADTS AAC audio, convert it to m4a")
+)
+
+const (
+	audioFormatM4A  = "m4a"
+	audioFormatAAC  = "aac"
+	audioFormatMP3  = "mp3"
+	audioFormatNone = ""
+)
+
+// ADTS AAC is measured but not uploaded, LINE rejects it
+var audioContentTypes = map[string]string{
+	audioFormatM4A: "audio/mp4",
+	audioFormatMP3: "audio/mpeg",
+}
+
+// AudioDuration returns duration of m4a, ADTS AAC or MP3 data in milliseconds
+func AudioDuration(data []byte) (int, error) {
+	switch detectAudioFormat(data) {
+	case audioFormatM4A:
+		return mp4Duration(data)
+	case audioFormatAAC:
+		return adtsDuration(data)
+	case audioFormatMP3:
+		return mp3Duration(data)
+	}
+
+	return 0, ErrorUnknownAudioFormat
+}
+
+func detectAudioFormat(data []byte) string {
+	if len(data) >= 8 && string(data[4:8]) == "ftyp" {
+		return audioFormatM4A
+	}
+
+	//ID3 tags are found in front of AAC as well as MP3, the frames after them tell
+	if len(data) >= 3 && string(data[0:3]) == "ID3" {
+		frames, e := skipID3(data)
+		if e != nil || len(frames) < 2 || frames[0] != 0xFF || frames[1]&0xF6 != 0xF0 {
+			return audioFormatMP3
+		}
+		return audioFormatAAC
+	}
+
+	if len(data) >= 2 && data[0] == 0xFF {
+		switch {
+		case data[1]&0xF6 == 0xF0:
+			return audioFormatAAC //ADTS: sync word + layer 00
+		case data[1]&0xE0 == 0xE0:
+			return audioFormatMP3
+		}
+	}
+
+	return audioFormatNone
+}
+
+// skipID3 returns data after its ID3v2 tag
+func skipID3(data []byte) ([]byte, error) {
+	if len(data) < 10 || string(data[0:3]) != "ID3" {
+		return data, nil
+	}
+
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	size += 10
+	if data[5]&0x10 != 0 {
+		size += 10 //footer
+	}
+	if size > len(data) {
+		return nil, ErrorInvalidAudioData
+	}
+	return data[size:], nil
+}
+
+func mp4Duration(data []byte) (int, error) {
+	moov := findMp4Box(data, "moov")
+	if moov == nil {
+		return 0, ErrorInvalidAudioData
+	}
+
+	mvhd := findMp4Box(moov, "mvhd")
+	if mvhd == nil || len(mvhd) < 20 {
+		return 0, ErrorInvalidAudioData
+	}
+
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return 0, ErrorInvalidAudioData
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0, ErrorInvalidAudioData
+	}
+
+	return int(duration * 1000 / timescale), nil
+}
+
+// findMp4Box returns the payload of the first box with the given type
+func findMp4Box(data []byte, boxType string) []byte {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		header := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+
+		if size < header || size > uint64(len(data)) {
+			return nil
+		}
+
+		if string(data[4:8]) == boxType {
+			return data[header:size]
+		}
+		data = data[size:]
+	}
+
+	return nil
+}
+
+var adtsSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+func adtsDuration(data []byte) (int, error) {
+	data, e := skipID3(data)
+	if e != nil {
+		return 0, e
+	}
+
+	samples := 0
+	sampleRate := 0
+
+	for len(data) >= 7 {
+		if data[0] != 0xFF || data[1]&0xF6 != 0xF0 {
+			break
+		}
+
+		rateIndex := int(data[2]>>2) & 0x0F
+		if rateIndex >= len(adtsSampleRates) {
+			return 0, ErrorInvalidAudioData
+		}
+		sampleRate = adtsSampleRates[rateIndex]
+
+		frameLen := int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5]>>5)
+		if frameLen < 7 || frameLen > len(data) {
+			break
+		}
+
+		samples += (int(data[6]&0x03) + 1) * 1024
+		data = data[frameLen:]
+	}
+
+	if sampleRate == 0 {
+		return 0, ErrorInvalidAudioData
+	}
+
+	return int(int64(samples) * 1000 / int64(sampleRate)), nil
+}
+
+var mp3Bitrates = [2][3][]int{
+	{ //MPEG 1
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{ //MPEG 2 & 2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mp3SampleRates = map[byte][]int{
+	3: {44100, 48000, 32000}, //MPEG 1
+	2: {22050, 24000, 16000}, //MPEG 2
+	0: {11025, 12000, 8000},  //MPEG 2.5
+}
+
+type mp3Frame struct {
+	length     int
+	samples    int
+	sampleRate int
+}
+
+func parseMp3Frame(h []byte) (*mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return nil, false
+	}
+
+	version := (h[1] >> 3) & 0x03
+	layer := (h[1] >> 1) & 0x03
+	bitrateIndex := int(h[2] >> 4)
+	rateIndex := int(h[2]>>2) & 0x03
+	padding := int(h[2]>>1) & 0x01
+
+	rates, ok := mp3SampleRates[version]
+	if !ok || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return nil, false
+	}
+
+	table := 0
+	if version != 3 {
+		table = 1
+	}
+	layerIndex := 3 - int(layer) //layer bits: 3 = Layer I, 1 = Layer III
+
+	bitrate := mp3Bitrates[table][layerIndex][bitrateIndex] * 1000
+	sampleRate := rates[rateIndex]
+
+	frame := &mp3Frame{sampleRate: sampleRate}
+	switch {
+	case layerIndex == 0:
+		frame.samples = 384
+		frame.length = (12*bitrate/sampleRate + padding) * 4
+	case layerIndex == 2 && version != 3:
+		frame.samples = 576
+		frame.length = 72*bitrate/sampleRate + padding
+	default:
+		frame.samples = 1152
+		frame.length = 144*bitrate/sampleRate + padding
+	}
+
+	return frame, true
+}
+
+func mp3Duration(data []byte) (int, error) {
+	data, e := skipID3(data)
+	if e != nil {
+		return 0, e
+	}
+
+	//Walk every frame so that both CBR and VBR files are measured correctly
+	var samples int64
+	sampleRate := 0
+	for len(data) >= 4 {
+		frame, ok := parseMp3Frame(data)
+		if !ok {
+			if sampleRate == 0 {
+				data = data[1:] //Resync before the first frame
+				continue
+			}
+			break
+		}
+
+		sampleRate = frame.sampleRate
+		samples += int64(frame.samples)
+
+		if frame.length > len(data) {
+			break
+		}
+		data = data[frame.length:]
+	}
+
+	if sampleRate == 0 {
+		return 0, ErrorInvalidAudioData
+	}
+
+	return int(samples * 1000 / int64(sampleRate)), nil
+}
+
+// AddAudioMessageWithData puts the audio to host and adds an audio message with detected
+// duration. m4a and MP3 are accepted, ADTS AAC fails with ErrorUnsupportedAudio
+func (mb *MessageBank) AddAudioMessageWithData(host MediaHost, name string, data []byte) error {
+	duration, e := AudioDuration(data)
+	if e != nil {
+		return e
+	}
+
+	contentType, ok := audioContentTypes[detectAudioFormat(data)]
+	if !ok {
+		return ErrorUnsupportedAudio
+	}
+
+	contentUrl, e := host.Put(name, contentType, data)
+	if e != nil {
+		return e
+	}
+
+	return mb.AddAudioMessage(contentUrl, duration)
+}
+
+func (mb *MessageBank) AddAudioMessageWithFile(host MediaHost, path string) error {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return e
+	}
+
+	return mb.AddAudioMessageWithData(host, filepath.Base(path), data)
+}
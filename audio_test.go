@@ -0,0 +1,108 @@
+package lbotx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(body)))
+	copy(box[4:8], boxType)
+	return append(box, body...)
+}
+
+func testM4A(timescale, duration uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:20], duration)
+
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		mp4Box("free"),
+		mp4Box("moov", mp4Box("mvhd", mvhd)),
+		mp4Box("mdat", make([]byte, 32)),
+	}, nil)
+}
+
+func testMP3(frames int) []byte {
+	//MPEG 1 Layer III, 128kbps, 44100Hz, no padding => 417 bytes per frame
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+
+	data := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 20}
+	data = append(data, make([]byte, 20)...)
+	for i := 0; i < frames; i++ {
+		data = append(data, frame...)
+	}
+	return data
+}
+
+func testADTS(frames int) []byte {
+	//MPEG-4 AAC LC, 44100Hz, stereo, 1 raw block per frame
+	frameLen := 16
+	frame := make([]byte, frameLen)
+	frame[0] = 0xFF
+	frame[1] = 0xF1
+	frame[2] = 0x50
+	frame[3] = 0x80 | byte(frameLen>>11)
+	frame[4] = byte(frameLen >> 3)
+	frame[5] = byte(frameLen<<5) | 0x1F
+	frame[6] = 0xFC
+
+	return bytes.Repeat(frame, frames)
+}
+
+func TestAudioDuration(t *testing.T) {
+	duration, e := AudioDuration(testM4A(44100, 44100*3))
+	assert.Nil(t, e)
+	assert.Equal(t, duration, 3000)
+
+	duration, e = AudioDuration(testMP3(100))
+	assert.Nil(t, e)
+	assert.Equal(t, duration, 100*1152*1000/44100)
+
+	duration, e = AudioDuration(testADTS(430))
+	assert.Nil(t, e)
+	assert.Equal(t, duration, 430*1024*1000/44100)
+
+	//ADTS behind an ID3 tag is still AAC
+	tagged := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0}, testADTS(430)...)
+	assert.Equal(t, detectAudioFormat(tagged), audioFormatAAC)
+	duration, e = AudioDuration(tagged)
+	assert.Nil(t, e)
+	assert.Equal(t, duration, 430*1024*1000/44100)
+	assert.Equal(t, detectAudioFormat(testMP3(1)), audioFormatMP3)
+
+	_, e = AudioDuration([]byte("not an audio file"))
+	assert.Equal(t, e, ErrorUnknownAudioFormat)
+
+	_, e = AudioDuration(testM4A(0, 100))
+	assert.Equal(t, e, ErrorInvalidAudioData)
+}
+
+func TestAddAudioMessageWithData(t *testing.T) {
+	host := NewMediaServer("https://example.com/media/")
+	mb := &MessageBank{}
+
+	e := mb.AddAudioMessageWithData(host, "hello.m4a", testM4A(1000, 1500))
+	assert.Nil(t, e)
+	assert.Equal(t, mb.Len(), 1)
+	assert.Equal(t, mb.messages[0], linebot.NewAudioMessage("https://example.com/media/hello.m4a", 1500))
+	assert.Equal(t, host.get("hello.m4a").contentType, "audio/mp4")
+
+	e = mb.AddAudioMessageWithData(host, "bad.m4a", []byte{1, 2, 3})
+	assert.NotNil(t, e)
+	assert.Equal(t, mb.Len(), 1)
+
+	//LINE rejects ADTS AAC, it's not uploaded
+	e = mb.AddAudioMessageWithData(host, "hello.aac", testADTS(10))
+	assert.Equal(t, e, ErrorUnsupportedAudio)
+	assert.Nil(t, host.get("hello.aac"))
+	assert.Equal(t, mb.Len(), 1)
+}
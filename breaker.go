@@ -0,0 +1,208 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitOpenError is returned instead of calling the LINE API while the circuit is open
+type CircuitOpenError struct {
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "Circuit breaker is open, LINE API calls fail fast until " + e.Until.Format(time.RFC3339)
+}
+
+func IsCircuitOpen(e error) bool {
+	var circuitError *CircuitOpenError
+	return errors.As(e, &circuitError)
+}
+
+// CircuitBreaker stops calling the LINE API after Threshold consecutive failures. Calls fail
+// fast with CircuitOpenError for Cooldown, then a single probe call decides whether the
+// circuit closes again. Network errors and server errors count as failures
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	Clock     Clock
+
+	lock     sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	opened   int //Times the circuit opened, calls started before are not recorded
+	probing  bool
+	onChange []func(from, to CircuitState)
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		Clock:     systemClock{},
+		state:     CircuitClosed,
+	}
+}
+
+// OnStateChange calls handler whenever the circuit opens, half opens or closes
+func (cb *CircuitBreaker) OnStateChange(handler func(from, to CircuitState)) {
+	cb.lock.Lock()
+	cb.onChange = append(cb.onChange, handler)
+	cb.lock.Unlock()
+}
+
+// State returns the current state. An open circuit past its cooldown is half open
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if cb.state == CircuitOpen && !cb.Clock.Now().Before(cb.openedAt.Add(cb.Cooldown)) {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// setState must be called with the lock held, it returns the handlers to call once released
+func (cb *CircuitBreaker) setState(state CircuitState) func() {
+	from := cb.state
+	if from == state {
+		return func() {}
+	}
+	cb.state = state
+
+	handlers := cb.onChange
+	return func() {
+		for _, handler := range handlers {
+			handler(from, state)
+		}
+	}
+}
+
+// allow lets a call go or fails with CircuitOpenError. Only one probe goes at a time while
+// half open. The call gives the generation returned to record or abort
+func (cb *CircuitBreaker) allow() (int, error) {
+	cb.lock.Lock()
+	notify := func() {}
+	defer func() {
+		cb.lock.Unlock()
+		notify()
+	}()
+
+	switch cb.state {
+	case CircuitOpen:
+		until := cb.openedAt.Add(cb.Cooldown)
+		if cb.Clock.Now().Before(until) {
+			return 0, &CircuitOpenError{until}
+		}
+		notify = cb.setState(CircuitHalfOpen)
+		cb.probing = true
+	case CircuitHalfOpen:
+		if cb.probing {
+			return 0, &CircuitOpenError{cb.Clock.Now()}
+		}
+		cb.probing = true
+	}
+	return cb.opened, nil
+}
+
+// record counts the result of a call. Calls allowed before the circuit last opened finish
+// late and are ignored, only the probe closes an open circuit
+func (cb *CircuitBreaker) record(generation int, failed bool) {
+	cb.lock.Lock()
+	notify := func() {}
+	defer func() {
+		cb.lock.Unlock()
+		notify()
+	}()
+
+	if generation != cb.opened {
+		return
+	}
+
+	cb.probing = false
+	if !failed {
+		cb.failures = 0
+		notify = cb.setState(CircuitClosed)
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.Threshold {
+		cb.openedAt = cb.Clock.Now()
+		cb.opened++
+		notify = cb.setState(CircuitOpen)
+	}
+}
+
+// abort gives up a call which never reached the API, letting another probe go
+func (cb *CircuitBreaker) abort(generation int) {
+	cb.lock.Lock()
+	if generation == cb.opened {
+		cb.probing = false
+	}
+	cb.lock.Unlock()
+}
+
+// Transport wraps base like lbotx.Transport and guards requests going through it, for
+// linebot clients created without NewBot
+func (cb *CircuitBreaker) Transport(base http.RoundTripper) http.RoundTripper {
+	t := Transport(base).(*apiTransport)
+	t.setBreaker(cb)
+	return t
+}
+
+// SetCircuitBreaker guards every LINE API call of the bot
+func (b *Bot) SetCircuitBreaker(cb *CircuitBreaker) {
+	if b.transport != nil {
+		b.transport.setBreaker(cb)
+	}
+}
+
+func (b *Bot) circuitBreaker() *CircuitBreaker {
+	if b.transport == nil {
+		return nil
+	}
+	return b.transport.breaker()
+}
+
+// CircuitState returns the state of the circuit breaker, closed when there is none
+func (b *Bot) CircuitState() CircuitState {
+	if cb := b.circuitBreaker(); cb != nil {
+		return cb.State()
+	}
+	return CircuitClosed
+}
+
+// CircuitState returns the state of the circuit breaker of the bot, e.g. for OnError
+// handlers to skip replies while the LINE API is down
+func (context *BotContext) CircuitState() CircuitState {
+	if context.breaker != nil {
+		return context.breaker.State()
+	}
+	return CircuitClosed
+}
+
+// HealthHandler answers health checks with the circuit state, with status 503 while open
+func (b *Bot) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		state := b.CircuitState()
+
+		w.Header().Set("Content-Type", "application/json")
+		if state == CircuitOpen {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]CircuitState{"circuit": state})
+	})
+}
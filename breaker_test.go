@@ -0,0 +1,122 @@
+package lbotx
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	down := true
+	calls := 0
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if down {
+			w.WriteHeader(503)
+			w.Write([]byte(`{"message":"unavailable"}`))
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte(`{"userId":"U1"}`))
+	}))
+	defer mockServer.Close()
+
+	clock := &fakeClock{time.Date(2024, 3, 8, 8, 0, 0, 0, time.UTC)}
+	cb := NewCircuitBreaker(3, time.Minute)
+	cb.Clock = clock
+
+	changes := []CircuitState{}
+	cb.OnStateChange(func(from, to CircuitState) {
+		changes = append(changes, to)
+	})
+
+	bot, _ := NewBot("test", "test")
+	bot.SetCircuitBreaker(cb)
+	bot.Client, _ = linebot.New("test", "test",
+		linebot.WithHTTPClient(&http.Client{
+			Transport: cb.Transport(&http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}),
+		}),
+		linebot.WithEndpointBase(mockServer.URL),
+	)
+
+	for i := 0; i < 3; i++ {
+		_, e := bot.GetProfile("U1").Do()
+		assert.False(t, IsCircuitOpen(e))
+	}
+	assert.Equal(t, cb.State(), CircuitOpen)
+	assert.Equal(t, bot.NewContext(nil).CircuitState(), CircuitOpen)
+
+	//Fails fast while open
+	_, e := bot.GetProfile("U1").Do()
+	assert.True(t, IsCircuitOpen(e))
+	assert.True(t, IsRetryable(e))
+	assert.Equal(t, calls, 3)
+
+	recorder := httptest.NewRecorder()
+	bot.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, recorder.Code, 503)
+	assert.Equal(t, recorder.Body.String(), "{\"circuit\":\"open\"}\n")
+
+	//A failed probe opens it again
+	clock.now = clock.now.Add(time.Minute)
+	assert.Equal(t, cb.State(), CircuitHalfOpen)
+	_, e = bot.GetProfile("U1").Do()
+	assert.False(t, IsCircuitOpen(e))
+	assert.Equal(t, cb.State(), CircuitOpen)
+	assert.Equal(t, calls, 4)
+
+	//A successful probe closes it
+	down = false
+	clock.now = clock.now.Add(time.Minute)
+	_, e = bot.GetProfile("U1").Do()
+	assert.Nil(t, e)
+	assert.Equal(t, cb.State(), CircuitClosed)
+	assert.Equal(t, changes, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed})
+
+	recorder = httptest.NewRecorder()
+	bot.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, recorder.Code, 200)
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	clock := &fakeClock{time.Now()}
+	cb := NewCircuitBreaker(1, time.Minute)
+	cb.Clock = clock
+
+	first, e := cb.allow()
+	assert.Nil(t, e)
+	late, _ := cb.allow()
+	cb.record(first, true)
+	_, e = cb.allow()
+	assert.True(t, IsCircuitOpen(e))
+
+	//A call allowed before the circuit opened doesn't close it
+	cb.record(late, false)
+	assert.Equal(t, cb.State(), CircuitOpen)
+
+	//Only one probe at a time
+	clock.now = clock.now.Add(time.Minute)
+	probe, e := cb.allow()
+	assert.Nil(t, e)
+	_, e = cb.allow()
+	assert.True(t, IsCircuitOpen(e))
+
+	//An aborted probe lets another one go, late calls don't
+	cb.abort(late)
+	_, e = cb.allow()
+	assert.True(t, IsCircuitOpen(e))
+	cb.abort(probe)
+	probe, e = cb.allow()
+	assert.Nil(t, e)
+	cb.record(probe, false)
+	_, e = cb.allow()
+	assert.Nil(t, e)
+	assert.Equal(t, cb.State(), CircuitClosed)
+}
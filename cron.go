@@ -0,0 +1,144 @@
+package lbotx
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorInvalidCron = errors.New("Invalid cron spec. Should be \"minute hour day month weekday\"")
+)
+
+// cronSchedule is a parsed "minute hour day month weekday" spec. Fields take *, numbers,
+// ranges a-b, steps */n, a-b/n or a/n (a to the end) and lists of them. Weekdays are 0-6
+// from Sunday, 7 is Sunday too
+type cronSchedule struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	anyDay     bool
+	anyWeekday bool
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		stepped := false
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, e := strconv.Atoi(part[idx+1:])
+			if e != nil || n < 1 {
+				return nil, ErrorInvalidCron
+			}
+			step, stepped = n, true
+			part = part[:idx]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var e error
+			if from, e = strconv.Atoi(bounds[0]); e != nil {
+				return nil, ErrorInvalidCron
+			}
+			if !stepped {
+				to = from
+			}
+			if len(bounds) == 2 {
+				if to, e = strconv.Atoi(bounds[1]); e != nil {
+					return nil, ErrorInvalidCron
+				}
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return nil, ErrorInvalidCron
+		}
+		for i := from; i <= to; i += step {
+			set[i] = true
+		}
+	}
+
+	return set, nil
+}
+
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, ErrorInvalidCron
+	}
+
+	c := &cronSchedule{
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+
+	var e error
+	if c.minutes, e = parseCronField(fields[0], 0, 59); e != nil {
+		return nil, e
+	}
+	if c.hours, e = parseCronField(fields[1], 0, 23); e != nil {
+		return nil, e
+	}
+	if c.days, e = parseCronField(fields[2], 1, 31); e != nil {
+		return nil, e
+	}
+	if c.months, e = parseCronField(fields[3], 1, 12); e != nil {
+		return nil, e
+	}
+	if c.weekdays, e = parseCronField(fields[4], 0, 7); e != nil {
+		return nil, e
+	}
+	if c.weekdays[7] {
+		c.weekdays[0] = true
+	}
+
+	return c, nil
+}
+
+// dayMatches follows cron: when both day and weekday are restricted, either may match
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.days[t.Day()]
+	weekday := c.weekdays[int(t.Weekday())]
+
+	if !c.anyDay && !c.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Next returns the first time after t matching the schedule, in the location of t. It
+// returns the zero time if nothing matches within five years, like "0 0 30 2 *"
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+
+	for t.Before(end) {
+		if !c.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
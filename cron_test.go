@@ -0,0 +1,36 @@
+package lbotx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCron(t *testing.T) {
+	taipei, _ := time.LoadLocation("Asia/Taipei")
+	from := time.Date(2024, 3, 6, 10, 30, 20, 0, taipei) //Wednesday
+
+	next := func(spec string) time.Time {
+		c, e := parseCron(spec)
+		assert.Nil(t, e)
+		return c.Next(from)
+	}
+
+	assert.Equal(t, next("* * * * *"), time.Date(2024, 3, 6, 10, 31, 0, 0, taipei))
+	assert.Equal(t, next("*/15 * * * *"), time.Date(2024, 3, 6, 10, 45, 0, 0, taipei))
+	assert.Equal(t, next("5/15 * * * *"), time.Date(2024, 3, 6, 10, 35, 0, 0, taipei))
+	assert.Equal(t, next("0 9 * * 1"), time.Date(2024, 3, 11, 9, 0, 0, 0, taipei))
+	assert.Equal(t, next("0 9 * * 1-5"), time.Date(2024, 3, 7, 9, 0, 0, 0, taipei))
+	assert.Equal(t, next("30 10 * * 3"), time.Date(2024, 3, 13, 10, 30, 0, 0, taipei))
+	assert.Equal(t, next("0 0 1 * *"), time.Date(2024, 4, 1, 0, 0, 0, 0, taipei))
+	assert.Equal(t, next("0 12 29 2 *"), time.Date(2028, 2, 29, 12, 0, 0, 0, taipei))
+	assert.Equal(t, next("0 8 10,20 * 0"), time.Date(2024, 3, 10, 8, 0, 0, 0, taipei))
+	assert.Equal(t, next("0 8 * * 7"), time.Date(2024, 3, 10, 8, 0, 0, 0, taipei))
+	assert.True(t, next("0 0 30 2 *").IsZero())
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, e := parseCron(spec)
+		assert.Equal(t, e, ErrorInvalidCron)
+	}
+}
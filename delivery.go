@@ -0,0 +1,190 @@
+package lbotx
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorNotAttempted = errors.New("Not sent because an earlier recipient failed")
+)
+
+const multicastLimit = 500
+
+// DeliveryReport has the outcome of every recipient of a send, in the order given
+type DeliveryReport struct {
+	Results []PushOutcome
+}
+
+func (r *DeliveryReport) Delivered() []string {
+	delivered := []string{}
+	for _, result := range r.Results {
+		if result.Err == nil {
+			delivered = append(delivered, result.To)
+		}
+	}
+	return delivered
+}
+
+// Failed returns recipients that failed or were not attempted
+func (r *DeliveryReport) Failed() []string {
+	failed := []string{}
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result.To)
+		}
+	}
+	return failed
+}
+
+// Err returns the first failure, nil if every recipient got the messages
+func (r *DeliveryReport) Err() error {
+	for _, result := range r.Results {
+		if result.Err != nil && result.Err != ErrorNotAttempted {
+			return result.Err
+		}
+	}
+	for _, result := range r.Results {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+func (pm *PostMan) WithContinueOnError(continueOnError bool) *PostMan {
+	pm.ContinueOnError = continueOnError
+	return pm
+}
+
+// Send pushes the queued messages to tos. Messages stay queued until every recipient got
+// them, so failed recipients can be resumed with Resume
+func (pm *PostMan) Send(tos ...string) *DeliveryReport {
+	return pm.send(tos, nil)
+}
+
+// send pushes to tos with their retry keys, new keys for recipients without one
+func (pm *PostMan) send(tos []string, retryKeys map[string]string) *DeliveryReport {
+	report := &DeliveryReport{}
+
+	failed := false
+	for _, to := range tos {
+		if failed && !pm.ContinueOnError {
+			report.Results = append(report.Results, PushOutcome{To: to, Err: ErrorNotAttempted})
+			continue
+		}
+
+		outcome := pm.pushWithRetry(to, retryKeys[to])
+		report.Results = append(report.Results, outcome)
+		failed = failed || outcome.Err != nil
+	}
+
+	if !failed {
+		//flush all messages
+		pm.messages = []linebot.Message{}
+		pm.templates = nil
+	}
+	return report
+}
+
+// Resume sends the queued messages to the recipients report failed and updates report.
+// Attempts add up to the attempts made before. Recipients keep their retry keys, so those
+// LINE got the messages from despite an error don't get them twice
+func (pm *PostMan) Resume(report *DeliveryReport) *DeliveryReport {
+	retryKeys := make(map[string]string)
+	for _, result := range report.Results {
+		if result.Err != nil && result.RetryKey != "" {
+			retryKeys[result.To] = result.RetryKey
+		}
+	}
+	resumed := pm.send(report.Failed(), retryKeys)
+
+	i := 0
+	for j, result := range report.Results {
+		if result.Err == nil {
+			continue
+		}
+
+		outcome := resumed.Results[i]
+		outcome.Attempts += result.Attempts
+		report.Results[j] = outcome
+		i++
+	}
+
+	return report
+}
+
+// Multicast sends the queued messages to tos in chunks of the most recipients LINE takes in
+// one request. Every recipient of a chunk gets the outcome of the chunk
+func (pm *PostMan) Multicast(tos ...string) *DeliveryReport {
+	if len(pm.templates) > 0 {
+		return notPersonalizable(tos)
+	}
+
+	chunks := [][]string{}
+	for len(tos) > multicastLimit {
+		chunks = append(chunks, tos[:multicastLimit])
+		tos = tos[multicastLimit:]
+	}
+	if len(tos) > 0 {
+		chunks = append(chunks, tos)
+	}
+
+	concurrency := pm.MulticastConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	outcomes := make([]PushOutcome, len(chunks))
+	sem := make(chan bool, concurrency)
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		if i > 0 && pm.MulticastInterval > 0 {
+			pm.wait(pm.MulticastInterval)
+		}
+
+		sem <- true
+		wg.Add(1)
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			outcomes[i] = pm.withRetry("", newRetryKey(), func(retryKey string) error {
+				return pm.multicast(chunk, retryKey)
+			})
+			<-sem
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	report := &DeliveryReport{}
+	for i, chunk := range chunks {
+		for _, to := range chunk {
+			outcome := outcomes[i]
+			outcome.To = to
+			pm.record(outcome)
+			report.Results = append(report.Results, outcome)
+		}
+	}
+
+	if report.Err() == nil {
+		pm.messages = []linebot.Message{}
+	}
+	return report
+}
+
+// Broadcast sends the queued messages to every follower. The report has a single result
+// with an empty To
+func (pm *PostMan) Broadcast() *DeliveryReport {
+	if len(pm.templates) > 0 {
+		return notPersonalizable([]string{""})
+	}
+
+	outcome := pm.withRetry("", newRetryKey(), pm.broadcast)
+
+	if outcome.Err == nil {
+		pm.messages = []linebot.Message{}
+	}
+	return &DeliveryReport{Results: []PushOutcome{outcome}}
+}
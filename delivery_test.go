@@ -0,0 +1,160 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryReport(t *testing.T) {
+	failing := map[string]bool{"U2": true, "U4": true}
+	pushed := []string{}
+	retryKeys := map[string][]string{}
+
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body := struct {
+			To string `json:"to"`
+		}{}
+		json.Unmarshal(data, &body)
+		pushed = append(pushed, body.To)
+		retryKeys[body.To] = append(retryKeys[body.To], req.Header.Get("X-Line-Retry-Key"))
+
+		if failing[body.To] {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"message":"The user hasn't added the bot as a friend"}`))
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	//Stops at the first failure by default
+	pm := bot.NewPostMan()
+	pm.AddTextMessage("hello")
+	report := pm.Send("U1", "U2", "U3", "U4")
+	assert.Equal(t, pushed, []string{"U1", "U2"})
+	assert.Equal(t, report.Delivered(), []string{"U1"})
+	assert.Equal(t, report.Failed(), []string{"U2", "U3", "U4"})
+	assert.Equal(t, report.Results[2].Err, ErrorNotAttempted)
+	assert.Equal(t, report.Results[2].Attempts, 0)
+
+	apiError, ok := AsAPIError(report.Err())
+	assert.True(t, ok)
+	assert.Equal(t, apiError.StatusCode, 400)
+	assert.Equal(t, pm.Len(), 1)
+
+	//Resume only the failed recipients
+	pushed = []string{}
+	failing["U2"] = false
+	pm.WithContinueOnError(true).Resume(report)
+	assert.Equal(t, pushed, []string{"U2", "U3", "U4"})
+	assert.Equal(t, report.Delivered(), []string{"U1", "U2", "U3"})
+	assert.Equal(t, report.Failed(), []string{"U4"})
+	assert.Equal(t, report.Results[1].Attempts, 2)
+	assert.Equal(t, report.Results[2].Attempts, 1)
+	assert.Equal(t, pm.Len(), 1)
+
+	//Same retry key as the failed attempt
+	assert.Equal(t, retryKeys["U2"][1], retryKeys["U2"][0])
+	assert.Equal(t, report.Results[1].RetryKey, retryKeys["U2"][0])
+
+	pushed = []string{}
+	failing["U4"] = false
+	pm.Resume(report)
+	assert.Equal(t, pushed, []string{"U4"})
+	assert.Nil(t, report.Err())
+	assert.Equal(t, report.Failed(), []string{})
+	assert.Equal(t, pm.Len(), 0)
+
+	//Continue on error
+	pushed = []string{}
+	failing["U2"] = true
+	pm.AddTextMessage("hello")
+	report = pm.Send("U1", "U2", "U3")
+	assert.Equal(t, pushed, []string{"U1", "U2", "U3"})
+	assert.Equal(t, report.Delivered(), []string{"U1", "U3"})
+
+	success, e := pm.WithContinueOnError(false).SendImmediately("U2", "U3")
+	assert.Equal(t, success, []string{})
+	assert.NotNil(t, e)
+}
+
+func TestMulticast(t *testing.T) {
+	lock := sync.Mutex{}
+	chunks := map[string]int{}
+	broadcasts := 0
+
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.RequestURI, "broadcast") {
+			broadcasts++
+			w.WriteHeader(200)
+			w.Write([]byte("{}"))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(req.Body)
+		body := struct {
+			To []string `json:"to"`
+		}{}
+		json.Unmarshal(data, &body)
+
+		lock.Lock()
+		chunks[body.To[0]] = len(body.To)
+		lock.Unlock()
+
+		if body.To[0] == "U500" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"message":"The request body has 1 error(s)"}`))
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	tos := []string{}
+	for i := 0; i < 1203; i++ {
+		tos = append(tos, "U"+strconv.Itoa(i))
+	}
+
+	pm := bot.NewPostMan()
+	pm.AddTextMessage("hello")
+	report := pm.Multicast(tos...)
+
+	assert.Equal(t, chunks, map[string]int{"U0": 500, "U500": 500, "U1000": 203})
+	assert.Equal(t, len(report.Results), 1203)
+	assert.Equal(t, len(report.Delivered()), 703)
+	assert.Equal(t, report.Failed()[0], "U500")
+	assert.Equal(t, report.Failed()[499], "U999")
+	assert.Equal(t, report.Results[1202].To, "U1202")
+	assert.Equal(t, report.Results[1202].Attempts, 1)
+	assert.NotNil(t, report.Err())
+
+	outcome, ok := pm.Outcome("U500")
+	assert.True(t, ok)
+	assert.NotNil(t, outcome.Err)
+	outcome, _ = pm.Outcome("U1202")
+	assert.Nil(t, outcome.Err)
+	assert.Equal(t, pm.Len(), 1)
+
+	report = pm.Broadcast()
+	assert.Equal(t, broadcasts, 1)
+	assert.Nil(t, report.Err())
+	assert.Equal(t, len(report.Results), 1)
+	assert.Equal(t, pm.Len(), 0)
+}
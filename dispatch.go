@@ -0,0 +1,220 @@
+package lbotx
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	textMessageType     = reflect.TypeOf((*linebot.TextMessage)(nil))
+	imageMessageType    = reflect.TypeOf((*linebot.ImageMessage)(nil))
+	videoMessageType    = reflect.TypeOf((*linebot.VideoMessage)(nil))
+	audioMessageType    = reflect.TypeOf((*linebot.AudioMessage)(nil))
+	fileMessageType     = reflect.TypeOf((*linebot.FileMessage)(nil))
+	locationMessageType = reflect.TypeOf((*linebot.LocationMessage)(nil))
+	stickerMessageType  = reflect.TypeOf((*linebot.StickerMessage)(nil))
+)
+
+// dispatchKey tells which events a handler wants. Empty eventType or nil messageType
+// matches any
+type dispatchKey struct {
+	eventType   linebot.EventType
+	messageType reflect.Type
+}
+
+var anyEvent = dispatchKey{}
+
+func (k dispatchKey) matches(event dispatchKey) bool {
+	return (k.eventType == "" || k.eventType == event.eventType) &&
+		(k.messageType == nil || k.messageType == event.messageType)
+}
+
+type handlerEntry struct {
+	name     string
+	priority int
+	seq      int
+	key      dispatchKey
+	handler  EventHandler
+	router   *Router
+	module   *Module //Set for the handler dispatching to a mounted module
+	hints    []hint
+	command  string //Name of a module command, hinted with the module prefix
+}
+
+// handlerTable indexes handlers by event and message type. Lookups return only handlers
+// that can accept the event, higher priority first and in registration order otherwise
+type handlerTable struct {
+	lock    sync.RWMutex
+	entries []handlerEntry
+	seq     int
+	names   map[string]bool
+	index   map[dispatchKey][]EventHandler
+}
+
+// reserve takes name for a handler, false if it is taken already
+func (t *handlerTable) reserve(name string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.names[name] {
+		return false
+	}
+	if t.names == nil {
+		t.names = make(map[string]bool)
+	}
+	t.names[name] = true
+	return true
+}
+
+func (t *handlerTable) add(entry handlerEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.seq++
+	entry.seq = t.seq
+	t.entries = append(t.entries, entry)
+	t.sort()
+}
+
+func (t *handlerTable) remove(name string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i := range t.entries {
+		if t.entries[i].name == name {
+			t.entries = append(t.entries[:i], t.entries[i+1:]...)
+			delete(t.names, name)
+			t.index = nil
+			return true
+		}
+	}
+	return false
+}
+
+// release frees name when it was reserved by Named but never taken by a handler, in the
+// table or in tables of mounted modules
+func (t *handlerTable) release(name string) bool {
+	t.lock.Lock()
+	reserved := t.names[name]
+	for _, entry := range t.entries {
+		if entry.name == name {
+			reserved = false
+		}
+	}
+	if reserved {
+		delete(t.names, name)
+	}
+	t.lock.Unlock()
+	if reserved {
+		return true
+	}
+
+	for _, entry := range t.snapshot() {
+		if entry.module != nil && entry.module.handlers.release(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// replace swaps the handler of the entry named name in place
+func (t *handlerTable) replace(name string, handler EventHandler) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i := range t.entries {
+		if t.entries[i].name == name {
+			t.entries[i].handler = handler
+			t.index = nil
+			return true
+		}
+	}
+	return false
+}
+
+// find looks for the entry named name in the table, then in tables of mounted modules
+func (t *handlerTable) find(name string) (*handlerTable, *handlerEntry) {
+	entries := t.snapshot()
+	for i := range entries {
+		if entries[i].name == name {
+			return t, &entries[i]
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.module != nil {
+			if table, found := entry.module.handlers.find(name); found != nil {
+				return table, found
+			}
+		}
+	}
+	return nil, nil
+}
+
+// sort orders entries and drops the index. Requests being served keep the handler slices
+// they got from lookup, since the index is rebuilt into new slices
+func (t *handlerTable) sort() {
+	sort.SliceStable(t.entries, func(i, j int) bool {
+		if t.entries[i].priority != t.entries[j].priority {
+			return t.entries[i].priority > t.entries[j].priority
+		}
+		return t.entries[i].seq < t.entries[j].seq
+	})
+	t.index = nil //Rebuilt lazily
+}
+
+func (t *handlerTable) snapshot() []handlerEntry {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	entries := make([]handlerEntry, len(t.entries))
+	copy(entries, t.entries)
+	return entries
+}
+
+func (t *handlerTable) handlers() []EventHandler {
+	handlers := []EventHandler{}
+	for _, entry := range t.snapshot() {
+		handlers = append(handlers, entry.handler)
+	}
+	return handlers
+}
+
+func eventKey(event *linebot.Event) dispatchKey {
+	key := dispatchKey{eventType: event.Type}
+	if event.Message != nil {
+		key.messageType = reflect.TypeOf(event.Message)
+	}
+	return key
+}
+
+func (t *handlerTable) lookup(event *linebot.Event) []EventHandler {
+	key := eventKey(event)
+
+	t.lock.RLock()
+	handlers, ok := t.index[key]
+	t.lock.RUnlock()
+	if ok {
+		return handlers
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		t.index = make(map[dispatchKey][]EventHandler)
+	}
+
+	handlers = []EventHandler{}
+	for _, entry := range t.entries {
+		if entry.key.matches(key) {
+			handlers = append(handlers, entry.handler)
+		}
+	}
+	t.index[key] = handlers
+
+	return handlers
+}
@@ -0,0 +1,122 @@
+package lbotx
+
+import (
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchOrder(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	trace := []string{}
+	bot.OnEvent(func(context *BotContext) (bool, error) {
+		trace = append(trace, "event")
+		return true, nil
+	})
+	bot.OnImage(func(context *BotContext, data []byte) (bool, error) {
+		trace = append(trace, "image")
+		return true, nil
+	})
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "text1")
+		return true, nil
+	})
+	bot.OnFollow(func(context *BotContext) (bool, error) {
+		trace = append(trace, "follow")
+		return true, nil
+	})
+	bot.InGroup().OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "group text")
+		return true, nil
+	})
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "text2")
+		return true, nil
+	})
+
+	user := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+	assert.Equal(t, len(bot.table.lookup(textEvent(user, "hi"))), 4)
+
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, trace, []string{"event", "text1", "text2"})
+
+	trace = []string{}
+	dispatch(bot, &linebot.Event{Type: linebot.EventTypeFollow, Source: user})
+	assert.Equal(t, trace, []string{"event", "follow"})
+
+	//Handlers added after a lookup are indexed too
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "text3")
+		return false, nil
+	})
+	trace = []string{}
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, trace, []string{"event", "text1", "text2", "text3"})
+}
+
+func benchmarkBot(n int) *Bot {
+	bot, _ := NewBot("test", "test")
+
+	for i := 0; i < n; i++ {
+		switch i % 5 {
+		case 0:
+			bot.OnText(func(context *BotContext, text string) (bool, error) {
+				return true, nil
+			})
+		case 1:
+			bot.OnImage(func(context *BotContext, data []byte) (bool, error) {
+				return true, nil
+			})
+		case 2:
+			bot.OnSticker(func(context *BotContext, sticker *linebot.StickerMessage) (bool, error) {
+				return true, nil
+			})
+		case 3:
+			bot.OnFollow(func(context *BotContext) (bool, error) {
+				return true, nil
+			})
+		case 4:
+			bot.OnPostback(func(context *BotContext, data string) (bool, error) {
+				return true, nil
+			})
+		}
+	}
+
+	return bot
+}
+
+func BenchmarkDispatchIndexed(b *testing.B) {
+	bot := benchmarkBot(500)
+	event := textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "hi")
+	context := bot.NewContext(event)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, handler := range bot.table.lookup(event) {
+			if next, e := handler(context); !next || e != nil {
+				break
+			}
+		}
+	}
+}
+
+// Walks every handler like dispatch did before the table, for comparison
+func BenchmarkDispatchLinear(b *testing.B) {
+	bot := benchmarkBot(500)
+	event := textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "hi")
+	context := bot.NewContext(event)
+	handlers := bot.table.handlers()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, handler := range handlers {
+			if next, e := handler(context); !next || e != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package lbotx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	_ "image/gif"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// ImageMapWidths are the widths LINE requests as BaseUrl/{width}
+var ImageMapWidths = []int{240, 300, 460, 700, 1040}
+
+const imageMapBaseWidth = 1040
+
+type imageMapImage struct {
+	img    image.Image
+	format string
+	tiles  map[int]*imageMapTile
+}
+
+// imageMapTile is rendered once, by the first request for it. Others wait for that one only
+type imageMapTile struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// ImageMapServer renders and serves every width variant of imagemap images on demand.
+// Mount it under BaseUrl with http.StripPrefix
+type ImageMapServer struct {
+	BaseUrl string
+	Quality int
+
+	lock   sync.Mutex
+	images map[string]*imageMapImage
+}
+
+func NewImageMapServer(baseUrl string) *ImageMapServer {
+	return &ImageMapServer{
+		BaseUrl: strings.TrimSuffix(baseUrl, "/"),
+		Quality: jpeg.DefaultQuality,
+		images:  make(map[string]*imageMapImage),
+	}
+}
+
+// Put registers a source image and returns its base url and base size
+func (s *ImageMapServer) Put(name string, data []byte) (string, int, int, error) {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return "", 0, 0, ErrorInvalidMediaName
+	}
+
+	img, format, e := image.Decode(bytes.NewReader(data))
+	if e != nil {
+		return "", 0, 0, e
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return "", 0, 0, ErrorInvalidMapSize
+	}
+
+	s.lock.Lock()
+	s.images[name] = &imageMapImage{
+		img:    img,
+		format: format,
+		tiles:  make(map[int]*imageMapTile),
+	}
+	s.lock.Unlock()
+
+	height := bounds.Dy() * imageMapBaseWidth / bounds.Dx()
+	return s.BaseUrl + "/" + escapePath(name), imageMapBaseWidth, height, nil
+}
+
+func (s *ImageMapServer) Remove(name string) {
+	s.lock.Lock()
+	delete(s.images, strings.Trim(name, "/"))
+	s.lock.Unlock()
+}
+
+func (s *ImageMapServer) tile(name string, width int) ([]byte, string, error) {
+	s.lock.Lock()
+	source := s.images[name]
+	if source == nil {
+		s.lock.Unlock()
+		return nil, "", nil
+	}
+
+	tile := source.tiles[width]
+	if tile == nil {
+		tile = &imageMapTile{}
+		source.tiles[width] = tile
+	}
+	s.lock.Unlock()
+
+	contentType := "image/png"
+	if source.format == "jpeg" {
+		contentType = "image/jpeg"
+	}
+
+	tile.once.Do(func() {
+		resized := resizeImage(source.img, width)
+		buf := bytes.NewBuffer(nil)
+
+		if source.format == "jpeg" {
+			tile.err = jpeg.Encode(buf, resized, &jpeg.Options{Quality: s.Quality})
+		} else {
+			tile.err = png.Encode(buf, resized)
+		}
+		tile.data = buf.Bytes()
+	})
+
+	if tile.err != nil {
+		return nil, "", tile.err
+	}
+	return tile.data, contentType, nil
+}
+
+func (s *ImageMapServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	if idx < 0 {
+		w.WriteHeader(404)
+		return
+	}
+
+	width, e := strconv.Atoi(path[idx+1:])
+	if e != nil || !isImageMapWidth(width) {
+		w.WriteHeader(404)
+		return
+	}
+
+	data, contentType, e := s.tile(path[:idx], width)
+	if e != nil {
+		w.WriteHeader(500)
+		return
+	}
+	if data == nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(200)
+	if req.Method != "HEAD" {
+		w.Write(data)
+	}
+}
+
+func isImageMapWidth(width int) bool {
+	for _, w := range ImageMapWidths {
+		if w == width {
+			return true
+		}
+	}
+	return false
+}
+
+// resizeImage scales img to the given width keeping aspect ratio. Each destination pixel is
+// the average of the source pixels it covers
+func resizeImage(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	height := srcH * width / srcW
+	if height == 0 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcH/height
+		y1 := bounds.Min.Y + (y+1)*srcH/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcW/width
+			x1 := bounds.Min.X + (x+1)*srcW/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				uint8(r / n >> 8),
+				uint8(g / n >> 8),
+				uint8(b / n >> 8),
+				uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
+
+// WithImage puts the image to server and sets BaseUrl, Width and Height from it
+func (ib *ImageMapBuilder) WithImage(server *ImageMapServer, name string, data []byte) error {
+	baseUrl, width, height, e := server.Put(name, data)
+	if e != nil {
+		return e
+	}
+
+	ib.BaseUrl = baseUrl
+	ib.Width = width
+	ib.Height = height
+	return nil
+}
+
+func (ib *ImageMapBuilder) WithImageFile(server *ImageMapServer, path string) error {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return e
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return ib.WithImage(server, name, data)
+}
+
+// relativeRect is an area in fractions of the base size
+type relativeRect struct {
+	x0, y0, x1, y1 float64
+}
+
+func percentRect(x, y, width, height float64) relativeRect {
+	return relativeRect{x / 100, y / 100, (x + width) / 100, (y + height) / 100}
+}
+
+func gridRect(rows, cols, row, col, rowSpan, colSpan int) relativeRect {
+	if rows < 1 || cols < 1 {
+		return relativeRect{} //Resolved to an empty area and rejected by Build
+	}
+
+	return relativeRect{
+		float64(col) / float64(cols),
+		float64(row) / float64(rows),
+		float64(col+colSpan) / float64(cols),
+		float64(row+rowSpan) / float64(rows),
+	}
+}
+
+// pixels resolves the rect to x, y, width and height. Adjacent rects never overlap or leave gaps
+func (r relativeRect) pixels(width, height int) (int, int, int, int) {
+	x0 := int(math.Floor(r.x0*float64(width) + 0.5))
+	y0 := int(math.Floor(r.y0*float64(height) + 0.5))
+	x1 := int(math.Floor(r.x1*float64(width) + 0.5))
+	y1 := int(math.Floor(r.y1*float64(height) + 0.5))
+
+	return x0, y0, x1 - x0, y1 - y0
+}
+
+func rectOverlaps(x0, y0, w0, h0, x1, y1, w1, h1 int) bool {
+	return x0 < x1+w1 && x1 < x0+w0 && y0 < y1+h1 && y1 < y0+h0
+}
+
+// imageMapLayoutAction is an action whose area is relative to the base size. It is
+// resolved to pixels when the builder is built so Width/Height can be set later
+type imageMapLayoutAction struct {
+	actionType linebot.ImagemapActionType
+	value      string
+	rect       relativeRect
+	before     int //Number of pixel actions added before it, to keep the insertion order
+}
+
+func (la *imageMapLayoutAction) resolve(width, height int) linebot.ImagemapAction {
+	x, y, w, h := la.rect.pixels(width, height)
+
+	area := linebot.ImagemapArea{x, y, w, h}
+	if la.actionType == linebot.ImagemapActionTypeURI {
+		return linebot.NewURIImagemapAction(la.value, area)
+	}
+	return linebot.NewMessageImagemapAction(la.value, area)
+}
+
+func (ib *ImageMapBuilder) addLayout(actionType linebot.ImagemapActionType, value string, rect relativeRect) {
+	ib.layouts = append(ib.layouts, &imageMapLayoutAction{
+		actionType: actionType,
+		value:      value,
+		rect:       rect,
+		before:     len(ib.actions),
+	})
+}
+
+func (ib *ImageMapBuilder) contains(area linebot.ImagemapArea) bool {
+	return area.X >= 0 && area.Y >= 0 && area.X+area.Width <= ib.Width && area.Y+area.Height <= ib.Height
+}
+
+func areaOverlaps(a, b linebot.ImagemapArea) bool {
+	return rectOverlaps(a.X, a.Y, a.Width, a.Height, b.X, b.Y, b.Width, b.Height)
+}
+
+// WithMessageActionPercent adds a message action with area given in percentage of the base size
+func (ib *ImageMapBuilder) WithMessageActionPercent(text string, x, y, width, height float64) *ImageMapBuilder {
+	ib.addLayout(linebot.ImagemapActionTypeMessage, text, percentRect(x, y, width, height))
+	return ib
+}
+
+// WithURIActionPercent adds an uri action with area given in percentage of the base size
+func (ib *ImageMapBuilder) WithURIActionPercent(linkURL string, x, y, width, height float64) *ImageMapBuilder {
+	ib.addLayout(linebot.ImagemapActionTypeURI, linkURL, percentRect(x, y, width, height))
+	return ib
+}
+
+// WithVideo plays a video in the given area. Use WithVideoLink to show a link after it ends
+func (ib *ImageMapBuilder) WithVideo(contentUrl, previewUrl string, x, y, width, height int) *ImageMapBuilder {
+	ib.video = &linebot.ImagemapVideo{
+		OriginalContentURL: contentUrl,
+		PreviewImageURL:    previewUrl,
+		Area:               linebot.ImagemapArea{x, y, width, height},
+	}
+	return ib
+}
+
+func (ib *ImageMapBuilder) WithVideoLink(linkUri, label string) *ImageMapBuilder {
+	if ib.video != nil {
+		ib.video.ExternalLink = &linebot.ImagemapVideoExternalLink{
+			LinkURI: linkUri,
+			Label:   label,
+		}
+	}
+	return ib
+}
+
+// ImageMapGrid divides the image map into rows x cols cells
+type ImageMapGrid struct {
+	builder *ImageMapBuilder
+	rows    int
+	cols    int
+}
+
+func (ib *ImageMapBuilder) Grid(rows, cols int) *ImageMapGrid {
+	return &ImageMapGrid{
+		builder: ib,
+		rows:    rows,
+		cols:    cols,
+	}
+}
+
+func (g *ImageMapGrid) add(actionType linebot.ImagemapActionType, value string, row, col, rowSpan, colSpan int) {
+	g.builder.addLayout(actionType, value, gridRect(g.rows, g.cols, row, col, rowSpan, colSpan))
+}
+
+func (g *ImageMapGrid) WithMessageAction(text string, row, col int) *ImageMapGrid {
+	return g.WithMessageActionSpan(text, row, col, 1, 1)
+}
+
+func (g *ImageMapGrid) WithMessageActionSpan(text string, row, col, rowSpan, colSpan int) *ImageMapGrid {
+	g.add(linebot.ImagemapActionTypeMessage, text, row, col, rowSpan, colSpan)
+	return g
+}
+
+func (g *ImageMapGrid) WithURIAction(linkURL string, row, col int) *ImageMapGrid {
+	return g.WithURIActionSpan(linkURL, row, col, 1, 1)
+}
+
+func (g *ImageMapGrid) WithURIActionSpan(linkURL string, row, col, rowSpan, colSpan int) *ImageMapGrid {
+	g.add(linebot.ImagemapActionTypeURI, linkURL, row, col, rowSpan, colSpan)
+	return g
+}
@@ -0,0 +1,143 @@
+package lbotx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageMapServer(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2080, 1040))
+	for y := 0; y < 1040; y++ {
+		for x := 0; x < 2080; x++ {
+			src.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	png.Encode(buf, src)
+
+	server := NewImageMapServer("https://example.com/imagemap/")
+	b := NewImageMapBuilder()
+	e := b.WithImage(server, "banner", buf.Bytes())
+	assert.Nil(t, e)
+	assert.Equal(t, b.BaseUrl, "https://example.com/imagemap/banner")
+	assert.Equal(t, b.Width, 1040)
+	assert.Equal(t, b.Height, 520)
+
+	e = b.WithImage(server, "broken", []byte("not an image"))
+	assert.NotNil(t, e)
+
+	ts := httptest.NewServer(http.StripPrefix("/imagemap", server))
+	defer ts.Close()
+
+	for _, width := range ImageMapWidths {
+		res, e := http.Get(ts.URL + "/imagemap/banner/" + strconv.Itoa(width))
+		assert.Nil(t, e)
+		assert.Equal(t, res.StatusCode, 200)
+		assert.Equal(t, res.Header.Get("Content-Type"), "image/png")
+
+		img, _, e := image.Decode(res.Body)
+		res.Body.Close()
+		assert.Nil(t, e)
+		assert.Equal(t, img.Bounds().Dx(), width)
+		assert.Equal(t, img.Bounds().Dy(), width/2)
+		r, g, _, _ := img.At(width/2, width/4).RGBA()
+		assert.Equal(t, r>>8, uint32(255))
+		assert.Equal(t, g>>8, uint32(0))
+	}
+	assert.Equal(t, len(server.images["banner"].tiles), len(ImageMapWidths))
+
+	res, _ := http.Get(ts.URL + "/imagemap/banner/500")
+	assert.Equal(t, res.StatusCode, 404)
+
+	res, _ = http.Get(ts.URL + "/imagemap/unknown/240")
+	assert.Equal(t, res.StatusCode, 404)
+
+	//Concurrent requests for a cold tile get the same rendering
+	server.Put("banner 2", buf.Bytes())
+	tiles := make(chan []byte, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			data, _, _ := server.tile("banner 2", 240)
+			tiles <- data
+		}()
+	}
+	first := <-tiles
+	for i := 1; i < 4; i++ {
+		assert.Equal(t, <-tiles, first)
+	}
+
+	baseUrl, _, _, _ := server.Put("banner 2", buf.Bytes())
+	assert.Equal(t, baseUrl, "https://example.com/imagemap/banner%202")
+}
+
+func TestImageMapLayout(t *testing.T) {
+	b := NewImageMapBuilder()
+	b.AltText = "altText"
+	b.BaseUrl = "https://example.com/imagemap/banner"
+	grid := b.Grid(2, 3)
+	grid.WithMessageActionSpan("wide", 0, 0, 1, 2)
+	grid.WithURIAction("https://example.com/1", 0, 2)
+	grid.WithMessageActionSpan("bottom", 1, 0, 1, 3)
+	b.Width = 1040
+	b.Height = 700
+
+	message, e := b.Build()
+	assert.Nil(t, e)
+
+	action1 := linebot.NewMessageImagemapAction("wide", linebot.ImagemapArea{0, 0, 693, 350})
+	action2 := linebot.NewURIImagemapAction("https://example.com/1", linebot.ImagemapArea{693, 0, 347, 350})
+	action3 := linebot.NewMessageImagemapAction("bottom", linebot.ImagemapArea{0, 350, 1040, 350})
+	expected := linebot.NewImagemapMessage("https://example.com/imagemap/banner", "altText", linebot.ImagemapBaseSize{1040, 700}, action1, action2, action3)
+	assert.Equal(t, message, expected)
+
+	b = NewImageMapBuilderWith("https://example.com/imagemap/banner", "altText", 1040, 1040)
+	b.WithMessageActionPercent("left", 0, 0, 50, 100)
+	b.WithMessageActionPercent("right", 50, 0, 50, 100)
+	message, e = b.Build()
+	assert.Nil(t, e)
+	assert.Equal(t, message.(*linebot.ImagemapMessage).Actions[1], linebot.NewMessageImagemapAction("right", linebot.ImagemapArea{520, 0, 520, 1040}))
+
+	b.WithMessageAction("overlap", 500, 500, 40, 40)
+	_, e = b.Build()
+	assert.Equal(t, e, ErrorAreaOverlap)
+
+	//Pixel and layout actions keep the order they were added in
+	b = NewImageMapBuilderWith("https://example.com/imagemap/banner", "altText", 1040, 1040)
+	b.WithMessageAction("first", 0, 0, 1040, 520)
+	b.WithMessageActionPercent("second", 0, 50, 50, 50)
+	b.WithMessageAction("third", 520, 520, 520, 520)
+	message, _ = b.Build()
+	texts := []string{}
+	for _, action := range message.(*linebot.ImagemapMessage).Actions {
+		texts = append(texts, action.(*linebot.MessageImagemapAction).Text)
+	}
+	assert.Equal(t, texts, []string{"first", "second", "third"})
+
+	b = NewImageMapBuilderWith("https://example.com/imagemap/banner", "altText", 1040, 1040)
+	b.Grid(2, 2).WithMessageAction("outside", 2, 0)
+	_, e = b.Build()
+	assert.Equal(t, e, ErrorAreaOutOfBounds)
+
+	b = NewImageMapBuilderWith("https://example.com/imagemap/banner", "altText", 1040, 1040)
+	b.WithMessageAction("bottom", 0, 520, 1040, 520)
+	b.WithVideo("https://example.com/video.mp4", "https://example.com/preview.jpg", 0, 0, 1040, 520)
+	b.WithVideoLink("https://example.com/more", "See more")
+	message, e = b.Build()
+	assert.Nil(t, e)
+	video := message.(*linebot.ImagemapMessage).Video
+	assert.Equal(t, video.Area, linebot.ImagemapArea{0, 0, 1040, 520})
+	assert.Equal(t, video.ExternalLink.LinkURI, "https://example.com/more")
+
+	b.WithVideo("https://example.com/video.mp4", "https://example.com/preview.jpg", 0, 600, 1040, 520)
+	_, e = b.Build()
+	assert.Equal(t, e, ErrorAreaOutOfBounds)
+}
@@ -0,0 +1,132 @@
+package lbotx
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// jsonLog is an append only file of json records, one per line, synced on every write.
+// Stores replay it when opened to rebuild their state
+type jsonLog struct {
+	lock    sync.Mutex
+	path    string
+	file    *os.File
+	records func() []interface{} //Records rebuilding the current state of the store
+}
+
+// openJSONLog replays the records of path through apply and opens it for appending.
+// Compact rewrites the file with records
+func openJSONLog(path string, apply func(line []byte) error, records func() []interface{}) (*jsonLog, error) {
+	size, e := replayJSONLog(path, apply)
+	if e != nil {
+		return nil, e
+	}
+
+	file, e := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if e != nil {
+		return nil, e
+	}
+
+	//Drop a line cut by a crash while writing, the next record would be glued to it
+	if e := file.Truncate(size); e != nil {
+		file.Close()
+		return nil, e
+	}
+
+	return &jsonLog{path: path, file: file, records: records}, nil
+}
+
+// replayJSONLog returns the size of the complete lines of path
+func replayJSONLog(path string, apply func(line []byte) error) (int64, error) {
+	file, e := os.Open(path)
+	if os.IsNotExist(e) {
+		return 0, nil
+	}
+	if e != nil {
+		return 0, e
+	}
+	defer file.Close()
+
+	size := int64(0)
+	reader := bufio.NewReader(file)
+	for {
+		line, e := reader.ReadBytes('\n')
+		if e == io.EOF {
+			return size, nil //A line without newline was cut by a crash while writing
+		}
+		if e != nil {
+			return 0, e
+		}
+
+		if e := apply(line); e != nil {
+			return 0, e
+		}
+		size += int64(len(line))
+	}
+}
+
+func writeJSONLine(file *os.File, record interface{}) error {
+	data, e := json.Marshal(record)
+	if e != nil {
+		return e
+	}
+
+	if _, e := file.Write(append(data, '\n')); e != nil {
+		return e
+	}
+	return file.Sync()
+}
+
+// write appends record and then applies it to the state of the store. Both happen under
+// the lock, so that Compact finds every record in the state
+func (l *jsonLog) write(record interface{}, apply func() error) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if e := writeJSONLine(l.file, record); e != nil {
+		return e
+	}
+	return apply()
+}
+
+// Compact rewrites the file with the current state of the store only, dropping the history
+func (l *jsonLog) Compact() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	tmp, e := os.OpenFile(l.path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if e != nil {
+		return e
+	}
+	for _, record := range l.records() {
+		if e := writeJSONLine(tmp, record); e != nil {
+			tmp.Close()
+			return e
+		}
+	}
+	if e := tmp.Close(); e != nil {
+		return e
+	}
+
+	l.file.Close()
+	renamed := os.Rename(l.path+".tmp", l.path)
+	if renamed != nil {
+		os.Remove(l.path + ".tmp")
+	}
+
+	//Reopened even when the rename failed, the old file is still there then
+	l.file, e = os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if e != nil {
+		return e
+	}
+	return renamed
+}
+
+func (l *jsonLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
@@ -5,8 +5,6 @@ import (
 	"net/http"
 	"regexp"
 
-	"reflect"
-
 	"io/ioutil"
 
 	"strings"
@@ -28,20 +26,33 @@ type BotContext struct {
 	Data        map[string]interface{}
 	Messages    *MessageBank
 	userProfile *UserProfile
+	menuStates  *MenuStates
+	breaker     *CircuitBreaker
 }
 
 type Bot struct {
 	*linebot.Client
+	*Router
 
-	handlers    []EventHandler
+	table       handlerTable
 	errHandlers []ErrorHandler
+	menuStates  *MenuStates
+
+	unhandledHandlers []EventHandler
+	errorReplies      *ErrorReplies
+	transport         *apiTransport
+	quota             *QuotaTracker
+	subscribers       *Subscribers
+
+	accountLinker *AccountLinker
 }
 
 type UserProfile struct {
-	Id      string
-	Name    string
-	Picture string
-	Status  string
+	Id       string
+	Name     string
+	Picture  string
+	Status   string
+	Language string
 }
 
 type EventHandler func(context *BotContext) (bool, error)
@@ -53,18 +64,59 @@ type BinaryDataHandler func(context *BotContext, data []byte) (bool, error)
 type LocationHandler func(context *BotContext, location *linebot.LocationMessage) (bool, error)
 type StickerHandler func(context *BotContext, sticker *linebot.StickerMessage) (bool, error)
 
+type FileHandler func(context *BotContext, fileName string, data []byte) (bool, error)
+
 type JoinHandler func(context *BotContext, joinType, id string) (bool, error)
 type LeaveHandler func(context *BotContext, groupId string) (bool, error)
+type MembersHandler func(context *BotContext, members []linebot.EventSource) (bool, error)
 type PostbackHandler func(context *BotContext, data string) (bool, error)
 type BeaconHandler func(context *BotContext, hwid string) (bool, error)
+type UnsendHandler func(context *BotContext, messageId string) (bool, error)
+type VideoPlayCompleteHandler func(context *BotContext, trackingId string) (bool, error)
+type AccountLinkEventHandler func(context *BotContext, nonce string, ok bool) (bool, error)
+type ThingsHandler func(context *BotContext, deviceId string) (bool, error)
+type ThingsResultHandler func(context *BotContext, deviceId string, result *linebot.ThingsResult) (bool, error)
+
+var knownEventTypes = map[linebot.EventType]bool{
+	linebot.EventTypeMessage:           true,
+	linebot.EventTypeFollow:            true,
+	linebot.EventTypeUnfollow:          true,
+	linebot.EventTypeJoin:              true,
+	linebot.EventTypeLeave:             true,
+	linebot.EventTypeMemberJoined:      true,
+	linebot.EventTypeMemberLeft:        true,
+	linebot.EventTypePostback:          true,
+	linebot.EventTypeBeacon:            true,
+	linebot.EventTypeAccountLink:       true,
+	linebot.EventTypeThings:            true,
+	linebot.EventTypeUnsend:            true,
+	linebot.EventTypeVideoPlayComplete: true,
+}
 
 func NewBot(channelSecret, channelToken string, options ...linebot.ClientOption) (*Bot, error) {
+	return NewBotWithClient(channelSecret, channelToken, &http.Client{}, options...)
+}
+
+// NewBotWithClient creates a bot calling the API through a copy of client whose transport
+// is wrapped with Transport, so that retry keys, rate limits and circuit breaking apply.
+// Give your own http client here, linebot.WithHTTPClient would replace the wrapped one
+func NewBotWithClient(channelSecret, channelToken string, client *http.Client, options ...linebot.ClientOption) (*Bot, error) {
+	transport, ok := client.Transport.(*apiTransport)
+	if !ok {
+		transport = Transport(client.Transport).(*apiTransport)
+	}
+	wrapped := *client
+	wrapped.Transport = transport
+
+	options = append([]linebot.ClientOption{linebot.WithHTTPClient(&wrapped)}, options...)
 	bot, e := linebot.New(channelSecret, channelToken, options...)
 	if e != nil {
 		return nil, e
 	}
 
-	return &Bot{Client: bot}, nil
+	b := &Bot{Client: bot, transport: transport}
+	b.Router = &Router{bot: b, table: &b.table}
+	return b, nil
 }
 
 func (b *Bot) NewContext(event *linebot.Event) *BotContext {
@@ -77,6 +129,8 @@ func (b *Bot) NewContext(event *linebot.Event) *BotContext {
 			bot: b.Client,
 		},
 		nil,
+		b.menuStates,
+		b.circuitBreaker(),
 	}
 
 	return context
@@ -95,29 +149,63 @@ func (b *Bot) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	for _, event := range events {
-		context := b.NewContext(event)
+		b.handleEvent(event)
+	}
+}
 
-		for _, handler := range b.handlers {
-			next, e := handler(context)
+func (b *Bot) handleError(context *BotContext, e error) {
+	for _, errHandler := range b.errHandlers {
+		errHandler(context, e)
+	}
+}
 
-			if e != nil {
-				for _, errHandler := range b.errHandlers {
-					errHandler(context, e)
-				}
-			}
+// runChain runs handlers until one of them stops the chain or fails
+func (b *Bot) runChain(context *BotContext, handlers []EventHandler) error {
+	for _, handler := range handlers {
+		next, e := handler(context)
 
-			if !next || e != nil {
-				break
-			}
+		if e != nil {
+			b.handleError(context, e)
+			return e
 		}
-		e := context.Messages.reply(event.ReplyToken)
 
-		if e != nil {
-			for _, errHandler := range b.errHandlers {
-				errHandler(context, e)
-			}
+		if !next {
+			break
+		}
+	}
+	return nil
+}
+
+func (b *Bot) handleEvent(event *linebot.Event) *BotContext {
+	context := b.NewContext(event)
+
+	if b.menuStates != nil {
+		if e := b.menuStates.onEvent(context); e != nil {
+			b.handleError(context, e)
+		}
+	}
+
+	if b.subscribers != nil {
+		if e := b.subscribers.onEvent(context); e != nil {
+			b.handleError(context, e)
 		}
 	}
+
+	e := b.runChain(context, b.table.lookup(event))
+	if e == nil && context.Messages.Len() == 0 {
+		e = b.runChain(context, b.unhandledHandlers)
+	}
+
+	if e != nil && b.errorReplies != nil && event.ReplyToken != "" {
+		context.Messages.messages = nil //Don't send half done replies
+		context.Messages.AddTextMessage(b.errorReplies.Message(b.cachedLanguage(context), e))
+	}
+
+	if e := context.Messages.reply(event.ReplyToken); e != nil {
+		b.handleError(context, e)
+	}
+
+	return context
 }
 
 func (b *Bot) Gin() func(*gin.Context) {
@@ -145,76 +233,86 @@ func (c *BotContext) GetUser() (*UserProfile, error) {
 		return nil, ErrorInvalidUserId
 	}
 
-	resp, e := c.bot.GetProfile(userId).Do()
+	profile, e := fetchProfile(c.bot, userId)
 	if e != nil {
 		return nil, e
 	}
 
-	c.userProfile = &UserProfile{
-		Id:      resp.UserID,
-		Name:    resp.DisplayName,
-		Picture: resp.PictureURL,
-		Status:  resp.StatusMessage,
-	}
+	c.userProfile = profile
 	return c.userProfile, nil
 }
 
+func fetchProfile(bot *linebot.Client, userId string) (*UserProfile, error) {
+	ctx, info := apiCall("")
+	resp, e := bot.GetProfile(userId).WithContext(ctx).Do()
+	if e != nil {
+		return nil, wrapAPIError(e, info)
+	}
+
+	return &UserProfile{
+		Id:       resp.UserID,
+		Name:     resp.DisplayName,
+		Picture:  resp.PictureURL,
+		Status:   resp.StatusMessage,
+		Language: resp.Language,
+	}, nil
+}
+
+// Language returns the language of the user's profile, or "" if it can't be known
+func (c *BotContext) Language() string {
+	user, e := c.GetUser()
+	if e != nil {
+		return ""
+	}
+	return user.Language
+}
+
 func (c *BotContext) GetUserId() string {
 	userId := c.Event.Source.UserID
 
 	return userId
 }
 
-func (b *Bot) OnEvent(handler EventHandler) {
-	if b.handlers == nil {
-		b.handlers = []EventHandler{handler}
-	} else {
-		b.handlers = append(b.handlers, handler)
-	}
+func (r *Router) OnText(handler TextMessageHandler) {
+	r.on(dispatchKey{linebot.EventTypeMessage, textMessageType}, textHandler(handler))
 }
 
-func (b *Bot) OnText(handler TextMessageHandler) {
-	eventHandler := func(context *BotContext) (bool, error) {
+// textHandler passes the text of text messages to handler and skips other events
+func textHandler(handler TextMessageHandler) EventHandler {
+	return func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeMessage {
 			return true, nil //Not a message. Continue.
 		}
 
-		if reflect.TypeOf(context.Event.Message) != reflect.TypeOf((*linebot.TextMessage)(nil)) {
+		msg, ok := context.Event.Message.(*linebot.TextMessage)
+		if !ok {
 			return true, nil
 		}
 
-		msg := context.Event.Message.(*linebot.TextMessage)
-
 		return handler(context, msg.Text)
 	}
-
-	b.OnEvent(eventHandler)
 }
 
-func (b *Bot) OnFilteredText(filter TextFilter, handler TextMessageHandler) {
-	eventHandler := func(context *BotContext) (bool, error) {
-		if context.Event.Type != linebot.EventTypeMessage {
-			return true, nil //Not a message. Continue.
-		}
-
-		if reflect.TypeOf(context.Event.Message) != reflect.TypeOf((*linebot.TextMessage)(nil)) {
-			return true, nil
-		}
-
-		msg := context.Event.Message.(*linebot.TextMessage)
-
-		if filter(context, msg.Text) {
-			return handler(context, msg.Text)
+func filteredTextHandler(filter TextFilter, handler TextMessageHandler) EventHandler {
+	return textHandler(func(context *BotContext, text string) (bool, error) {
+		if filter(context, text) {
+			return handler(context, text)
 		} else {
 			return true, nil
 		}
-	}
+	})
+}
 
-	b.OnEvent(eventHandler)
+func (r *Router) OnFilteredText(filter TextFilter, handler TextMessageHandler) {
+	r.on(dispatchKey{linebot.EventTypeMessage, textMessageType}, filteredTextHandler(filter, handler))
 }
 
-func (b *Bot) OnTextWith(template string, handler TextMessageHandler) {
+func (r *Router) OnTextWith(template string, handler TextMessageHandler) {
 	templReg, _ := regexp.Compile("\\\\{\\\\{(\\w+)\\\\}\\\\}")
+	entry := handlerEntry{key: dispatchKey{linebot.EventTypeMessage, textMessageType}}
+	if h, ok := templateHint(template); ok {
+		entry.hints = []hint{h}
+	}
 	template = regexp.QuoteMeta(template)
 
 	matches := templReg.FindAllStringSubmatch(template, -1)
@@ -248,21 +346,20 @@ func (b *Bot) OnTextWith(template string, handler TextMessageHandler) {
 
 		return true
 	}
-	b.OnFilteredText(filter, handler)
+	r.add(entry, filteredTextHandler(filter, handler))
 }
 
-func (b *Bot) OnImage(handler BinaryDataHandler) {
+func (r *Router) OnImage(handler BinaryDataHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeMessage {
 			return true, nil //Not a message. Continue.
 		}
 
-		if reflect.TypeOf(context.Event.Message) != reflect.TypeOf((*linebot.ImageMessage)(nil)) {
+		msg, ok := context.Event.Message.(*linebot.ImageMessage)
+		if !ok {
 			return true, nil
 		}
 
-		msg := context.Event.Message.(*linebot.ImageMessage)
-
 		resp, err := context.bot.GetMessageContent(msg.ID).Do()
 
 		if err != nil {
@@ -279,22 +376,21 @@ func (b *Bot) OnImage(handler BinaryDataHandler) {
 		return handler(context, data)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{linebot.EventTypeMessage, imageMessageType}, eventHandler)
 
 }
 
-func (b *Bot) OnVideo(handler BinaryDataHandler) {
+func (r *Router) OnVideo(handler BinaryDataHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeMessage {
 			return true, nil //Not a message. Continue.
 		}
 
-		if reflect.TypeOf(context.Event.Message) != reflect.TypeOf((*linebot.VideoMessage)(nil)) {
+		msg, ok := context.Event.Message.(*linebot.VideoMessage)
+		if !ok {
 			return true, nil
 		}
 
-		msg := context.Event.Message.(*linebot.VideoMessage)
-
 		resp, err := context.bot.GetMessageContent(msg.ID).Do()
 
 		if err != nil {
@@ -311,22 +407,21 @@ func (b *Bot) OnVideo(handler BinaryDataHandler) {
 		return handler(context, data)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{linebot.EventTypeMessage, videoMessageType}, eventHandler)
 
 }
 
-func (b *Bot) OnAudio(handler BinaryDataHandler) {
+func (r *Router) OnAudio(handler BinaryDataHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeMessage {
 			return true, nil //Not a message. Continue.
 		}
 
-		if reflect.TypeOf(context.Event.Message) != reflect.TypeOf((*linebot.AudioMessage)(nil)) {
+		msg, ok := context.Event.Message.(*linebot.AudioMessage)
+		if !ok {
 			return true, nil
 		}
 
-		msg := context.Event.Message.(*linebot.AudioMessage)
-
 		resp, err := context.bot.GetMessageContent(msg.ID).Do()
 
 		if err != nil {
@@ -343,47 +438,45 @@ func (b *Bot) OnAudio(handler BinaryDataHandler) {
 		return handler(context, data)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{linebot.EventTypeMessage, audioMessageType}, eventHandler)
 
 }
 
-func (b *Bot) OnLocation(handler LocationHandler) {
+func (r *Router) OnLocation(handler LocationHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeMessage {
 			return true, nil //Not a message. Continue.
 		}
 
-		if reflect.TypeOf(context.Event.Message) != reflect.TypeOf((*linebot.LocationMessage)(nil)) {
+		msg, ok := context.Event.Message.(*linebot.LocationMessage)
+		if !ok {
 			return true, nil
 		}
 
-		msg := context.Event.Message.(*linebot.LocationMessage)
-
 		return handler(context, msg)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{linebot.EventTypeMessage, locationMessageType}, eventHandler)
 }
 
-func (b *Bot) OnSticker(handler StickerHandler) {
+func (r *Router) OnSticker(handler StickerHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeMessage {
 			return true, nil //Not a message. Continue.
 		}
 
-		if reflect.TypeOf(context.Event.Message) != reflect.TypeOf((*linebot.StickerMessage)(nil)) {
+		msg, ok := context.Event.Message.(*linebot.StickerMessage)
+		if !ok {
 			return true, nil
 		}
 
-		msg := context.Event.Message.(*linebot.StickerMessage)
-
 		return handler(context, msg)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{linebot.EventTypeMessage, stickerMessageType}, eventHandler)
 }
 
-func (b *Bot) OnFollow(handler EventHandler) {
+func (r *Router) OnFollow(handler EventHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeFollow {
 			return true, nil //Not a message. Continue.
@@ -392,10 +485,10 @@ func (b *Bot) OnFollow(handler EventHandler) {
 		return handler(context)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{eventType: linebot.EventTypeFollow}, eventHandler)
 }
 
-func (b *Bot) OnUnFollow(handler EventHandler) {
+func (r *Router) OnUnFollow(handler EventHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeUnfollow {
 			return true, nil //Not a message. Continue.
@@ -404,10 +497,10 @@ func (b *Bot) OnUnFollow(handler EventHandler) {
 		return handler(context)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{eventType: linebot.EventTypeUnfollow}, eventHandler)
 }
 
-func (b *Bot) OnJoin(handler JoinHandler) {
+func (r *Router) OnJoin(handler JoinHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeJoin {
 			return true, nil //Not a message. Continue.
@@ -425,10 +518,10 @@ func (b *Bot) OnJoin(handler JoinHandler) {
 		return handler(context, string(context.Event.Source.Type), id)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{eventType: linebot.EventTypeJoin}, eventHandler)
 }
 
-func (b *Bot) OnLeave(handler LeaveHandler) {
+func (r *Router) OnLeave(handler LeaveHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeLeave {
 			return true, nil //Not a message. Continue.
@@ -443,10 +536,10 @@ func (b *Bot) OnLeave(handler LeaveHandler) {
 		return handler(context, id)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{eventType: linebot.EventTypeLeave}, eventHandler)
 }
 
-func (b *Bot) OnPostback(handler PostbackHandler) {
+func (r *Router) OnPostback(handler PostbackHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypePostback {
 			return true, nil //Not a message. Continue.
@@ -455,10 +548,10 @@ func (b *Bot) OnPostback(handler PostbackHandler) {
 		return handler(context, context.Event.Postback.Data)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{eventType: linebot.EventTypePostback}, eventHandler)
 }
 
-func (b *Bot) OnBeaconEnter(handler BeaconHandler) {
+func (r *Router) OnBeaconEnter(handler BeaconHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeBeacon {
 			return true, nil //Not a message. Continue.
@@ -471,10 +564,10 @@ func (b *Bot) OnBeaconEnter(handler BeaconHandler) {
 		return handler(context, context.Event.Beacon.Hwid)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{eventType: linebot.EventTypeBeacon}, eventHandler)
 }
 
-func (b *Bot) OnBeaconLeave(handler BeaconHandler) {
+func (r *Router) OnBeaconLeave(handler BeaconHandler) {
 	eventHandler := func(context *BotContext) (bool, error) {
 		if context.Event.Type != linebot.EventTypeBeacon {
 			return true, nil //Not a message. Continue.
@@ -487,7 +580,144 @@ func (b *Bot) OnBeaconLeave(handler BeaconHandler) {
 		return handler(context, context.Event.Beacon.Hwid)
 	}
 
-	b.OnEvent(eventHandler)
+	r.on(dispatchKey{eventType: linebot.EventTypeBeacon}, eventHandler)
+}
+
+func (r *Router) OnFile(handler FileHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeMessage {
+			return true, nil //Not a message. Continue.
+		}
+
+		msg, ok := context.Event.Message.(*linebot.FileMessage)
+		if !ok {
+			return true, nil
+		}
+
+		resp, err := context.bot.GetMessageContent(msg.ID).Do()
+
+		if err != nil {
+			return false, err //Error occured. Don't continue
+		}
+
+		defer resp.Content.Close()
+		data, err := ioutil.ReadAll(resp.Content)
+
+		if err != nil {
+			return false, err //Error occured. Don't continue
+		}
+
+		return handler(context, msg.FileName, data)
+	}
+
+	r.on(dispatchKey{linebot.EventTypeMessage, fileMessageType}, eventHandler)
+}
+
+func (r *Router) OnMemberJoined(handler MembersHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeMemberJoined || context.Event.Joined == nil {
+			return true, nil
+		}
+
+		return handler(context, context.Event.Joined.Members)
+	}
+
+	r.on(dispatchKey{eventType: linebot.EventTypeMemberJoined}, eventHandler)
+}
+
+func (r *Router) OnMemberLeft(handler MembersHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeMemberLeft || context.Event.Left == nil {
+			return true, nil
+		}
+
+		return handler(context, context.Event.Left.Members)
+	}
+
+	r.on(dispatchKey{eventType: linebot.EventTypeMemberLeft}, eventHandler)
+}
+
+func (r *Router) OnUnsend(handler UnsendHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeUnsend || context.Event.Unsend == nil {
+			return true, nil
+		}
+
+		return handler(context, context.Event.Unsend.MessageID)
+	}
+
+	r.on(dispatchKey{eventType: linebot.EventTypeUnsend}, eventHandler)
+}
+
+func (r *Router) OnVideoPlayComplete(handler VideoPlayCompleteHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeVideoPlayComplete || context.Event.VideoPlayComplete == nil {
+			return true, nil
+		}
+
+		return handler(context, context.Event.VideoPlayComplete.TrackingID)
+	}
+
+	r.on(dispatchKey{eventType: linebot.EventTypeVideoPlayComplete}, eventHandler)
+}
+
+func (r *Router) OnAccountLinkEvent(handler AccountLinkEventHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeAccountLink || context.Event.AccountLink == nil {
+			return true, nil
+		}
+
+		link := context.Event.AccountLink
+		return handler(context, link.Nonce, link.Result == linebot.AccountLinkResultOK)
+	}
+
+	r.on(dispatchKey{eventType: linebot.EventTypeAccountLink}, eventHandler)
+}
+
+func (r *Router) onThings(thingsType string, handler ThingsResultHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeThings || context.Event.Things == nil {
+			return true, nil
+		}
+
+		things := context.Event.Things
+		if things.Type != thingsType {
+			return true, nil
+		}
+
+		return handler(context, things.DeviceID, things.Result)
+	}
+
+	r.on(dispatchKey{eventType: linebot.EventTypeThings}, eventHandler)
+}
+
+func (r *Router) OnThingsLink(handler ThingsHandler) {
+	r.onThings("link", func(context *BotContext, deviceId string, result *linebot.ThingsResult) (bool, error) {
+		return handler(context, deviceId)
+	})
+}
+
+func (r *Router) OnThingsUnlink(handler ThingsHandler) {
+	r.onThings("unlink", func(context *BotContext, deviceId string, result *linebot.ThingsResult) (bool, error) {
+		return handler(context, deviceId)
+	})
+}
+
+func (r *Router) OnThingsScenarioResult(handler ThingsResultHandler) {
+	r.onThings("scenarioResult", handler)
+}
+
+// OnUnknownEvent handles events of types lbotx has no typed registration for
+func (r *Router) OnUnknownEvent(handler EventHandler) {
+	eventHandler := func(context *BotContext) (bool, error) {
+		if knownEventTypes[context.Event.Type] {
+			return true, nil
+		}
+
+		return handler(context)
+	}
+
+	r.on(anyEvent, eventHandler)
 }
 
 type ErrorHandler func(context *BotContext, err error)
@@ -207,13 +207,13 @@ func TestOnTextWith(t *testing.T) {
 	}
 
 	context := bot.NewContext(event)
-	bot.handlers[0](context)
+	bot.table.handlers()[0](context)
 	val := context.Get("test")
 	assert.NotNil(t, val)
 
 	context = bot.NewContext(event)
 	event.Message.(*linebot.TextMessage).Text = "Test another. No one will handle this"
-	bot.handlers[0](context)
+	bot.table.handlers()[0](context)
 	val = context.Get("test")
 	assert.Nil(t, val)
 }
@@ -223,11 +223,11 @@ func mockClient(server *httptest.Server) (*linebot.Client, error) {
 		"test",
 		"test",
 		linebot.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
+			Transport: Transport(&http.Transport{
 				TLSClientConfig: &tls.Config{
 					InsecureSkipVerify: true,
 				},
-			},
+			}),
 		}),
 		linebot.WithEndpointBase(server.URL),
 	)
@@ -237,6 +237,36 @@ func mockClient(server *httptest.Server) (*linebot.Client, error) {
 	return client, nil
 }
 
+func TestNewBotWithClient(t *testing.T) {
+	retryKeys := []string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		retryKeys = append(retryKeys, req.Header.Get("X-Line-Retry-Key"))
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	base := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	client := &http.Client{Transport: base}
+	bot, e := NewBotWithClient("test", "test", client,
+		linebot.WithEndpointBase(server.URL),
+	)
+	assert.Nil(t, e)
+	assert.Equal(t, client.Transport, base) //Not changed for other users of the client
+	assert.Equal(t, bot.transport.base, base)
+
+	pm := bot.NewPostMan().WithRetryPolicy(NoRetry)
+	pm.AddTextMessage("hello")
+	_, e = pm.SendImmediately("U1")
+	assert.Nil(t, e)
+	assert.Equal(t, len(retryKeys), 1)
+	assert.NotEqual(t, retryKeys[0], "")
+
+	cb := NewCircuitBreaker(5, time.Minute)
+	bot.SetCircuitBreaker(cb)
+	assert.Equal(t, bot.circuitBreaker(), cb)
+}
+
 func TestServer(t *testing.T) {
 	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		uri := req.RequestURI
@@ -442,3 +472,94 @@ func TestServer(t *testing.T) {
 	}
 	assert.Equal(t, tested, 11)
 }
+
+func TestModernEvents(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte{1, 2, 3})
+	}))
+	defer mockServer.Close()
+
+	mockClient, _ := mockClient(mockServer)
+	bot, _ := NewBot("test", "test")
+	bot.Client = mockClient
+
+	handled := []string{}
+	bot.OnFile(func(context *BotContext, fileName string, data []byte) (bool, error) {
+		assert.Equal(t, fileName, "report.pdf")
+		assert.Equal(t, data, []byte{1, 2, 3})
+		handled = append(handled, "file")
+		return false, nil
+	})
+	bot.OnMemberJoined(func(context *BotContext, members []linebot.EventSource) (bool, error) {
+		assert.Equal(t, members[0].UserID, "U1")
+		handled = append(handled, "joined")
+		return false, nil
+	})
+	bot.OnMemberLeft(func(context *BotContext, members []linebot.EventSource) (bool, error) {
+		assert.Equal(t, len(members), 2)
+		handled = append(handled, "left")
+		return false, nil
+	})
+	bot.OnUnsend(func(context *BotContext, messageId string) (bool, error) {
+		assert.Equal(t, messageId, "325708")
+		handled = append(handled, "unsend")
+		return false, nil
+	})
+	bot.OnVideoPlayComplete(func(context *BotContext, trackingId string) (bool, error) {
+		assert.Equal(t, trackingId, "track-1")
+		handled = append(handled, "video")
+		return false, nil
+	})
+	bot.OnAccountLinkEvent(func(context *BotContext, nonce string, ok bool) (bool, error) {
+		assert.Equal(t, nonce, "xxxxxxxxxxxxxxx")
+		assert.True(t, ok)
+		handled = append(handled, "link")
+		return false, nil
+	})
+	bot.OnThingsLink(func(context *BotContext, deviceId string) (bool, error) {
+		assert.Equal(t, deviceId, "t2c449c9d1")
+		handled = append(handled, "thingsLink")
+		return false, nil
+	})
+	bot.OnThingsUnlink(func(context *BotContext, deviceId string) (bool, error) {
+		handled = append(handled, "thingsUnlink")
+		return false, nil
+	})
+	bot.OnThingsScenarioResult(func(context *BotContext, deviceId string, result *linebot.ThingsResult) (bool, error) {
+		assert.Equal(t, result.ScenarioID, "dummy_scenario_id")
+		handled = append(handled, "scenario")
+		return false, nil
+	})
+	bot.OnUnknownEvent(func(context *BotContext) (bool, error) {
+		handled = append(handled, "unknown:"+string(context.Event.Type))
+		return false, nil
+	})
+
+	source := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C1", UserID: "U1"}
+	events := []*linebot.Event{
+		{Type: linebot.EventTypeMessage, Source: source, Message: &linebot.FileMessage{ID: "325708", FileName: "report.pdf", FileSize: 3}},
+		{Type: linebot.EventTypeMemberJoined, Source: source, Joined: &linebot.Members{Members: []linebot.EventSource{{Type: linebot.EventSourceTypeUser, UserID: "U1"}}}},
+		{Type: linebot.EventTypeMemberLeft, Source: source, Left: &linebot.Members{Members: []linebot.EventSource{{UserID: "U1"}, {UserID: "U2"}}}},
+		{Type: linebot.EventTypeUnsend, Source: source, Unsend: &linebot.Unsend{MessageID: "325708"}},
+		{Type: linebot.EventTypeVideoPlayComplete, Source: source, VideoPlayComplete: &linebot.VideoPlayComplete{TrackingID: "track-1"}},
+		{Type: linebot.EventTypeAccountLink, Source: source, AccountLink: &linebot.AccountLink{Result: linebot.AccountLinkResultOK, Nonce: "xxxxxxxxxxxxxxx"}},
+		{Type: linebot.EventTypeThings, Source: source, Things: &linebot.Things{DeviceID: "t2c449c9d1", Type: "link"}},
+		{Type: linebot.EventTypeThings, Source: source, Things: &linebot.Things{DeviceID: "t2c449c9d1", Type: "unlink"}},
+		{Type: linebot.EventTypeThings, Source: source, Things: &linebot.Things{DeviceID: "t2c449c9d1", Type: "scenarioResult", Result: &linebot.ThingsResult{ScenarioID: "dummy_scenario_id"}}},
+		{Type: linebot.EventType("activated"), Source: source},
+	}
+
+	for _, event := range events {
+		context := bot.NewContext(event)
+		for _, handler := range bot.table.handlers() {
+			next, e := handler(context)
+			assert.Nil(t, e)
+			if !next {
+				break
+			}
+		}
+	}
+
+	assert.Equal(t, handled, []string{"file", "joined", "left", "unsend", "video", "link", "thingsLink", "thingsUnlink", "scenario", "unknown:activated"})
+}
@@ -0,0 +1,95 @@
+package lbotx
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorInvalidMediaName = errors.New("Invalid media name")
+)
+
+// MediaHost stores content and returns a public https url LINE can fetch it from
+type MediaHost interface {
+	Put(name, contentType string, data []byte) (string, error)
+}
+
+type mediaFile struct {
+	contentType string
+	data        []byte
+	modified    time.Time
+}
+
+// MediaServer is an in-memory MediaHost. Mount it under BaseUrl with http.StripPrefix
+type MediaServer struct {
+	BaseUrl string
+
+	lock  sync.RWMutex
+	files map[string]*mediaFile
+}
+
+func NewMediaServer(baseUrl string) *MediaServer {
+	return &MediaServer{
+		BaseUrl: strings.TrimSuffix(baseUrl, "/"),
+		files:   make(map[string]*mediaFile),
+	}
+}
+
+func (ms *MediaServer) Put(name, contentType string, data []byte) (string, error) {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return "", ErrorInvalidMediaName
+	}
+
+	ms.lock.Lock()
+	ms.files[name] = &mediaFile{
+		contentType: contentType,
+		data:        data,
+		modified:    time.Now(),
+	}
+	ms.lock.Unlock()
+
+	return ms.BaseUrl + "/" + escapePath(name), nil
+}
+
+// escapePath escapes each segment of name for urls. Requests come back unescaped in
+// req.URL.Path
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (ms *MediaServer) Remove(name string) {
+	ms.lock.Lock()
+	delete(ms.files, strings.Trim(name, "/"))
+	ms.lock.Unlock()
+}
+
+func (ms *MediaServer) get(name string) *mediaFile {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	return ms.files[strings.Trim(name, "/")]
+}
+
+func (ms *MediaServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	file := ms.get(req.URL.Path)
+	if file == nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	w.Header().Set("Content-Type", file.contentType)
+	w.Header().Set("Last-Modified", file.modified.UTC().Format(http.TimeFormat))
+	w.WriteHeader(200)
+	if req.Method != "HEAD" {
+		w.Write(file.data)
+	}
+}
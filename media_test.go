@@ -0,0 +1,44 @@
+package lbotx
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaServer(t *testing.T) {
+	ms := NewMediaServer("https://example.com/media")
+
+	url, e := ms.Put("/voice/hello.m4a", "audio/mp4", []byte{1, 2, 3})
+	assert.Nil(t, e)
+	assert.Equal(t, url, "https://example.com/media/voice/hello.m4a")
+
+	_, e = ms.Put("", "audio/mp4", []byte{1})
+	assert.Equal(t, e, ErrorInvalidMediaName)
+
+	server := httptest.NewServer(http.StripPrefix("/media", ms))
+	defer server.Close()
+
+	res, e := http.Get(server.URL + "/media/voice/hello.m4a")
+	assert.Nil(t, e)
+	assert.Equal(t, res.StatusCode, 200)
+	assert.Equal(t, res.Header.Get("Content-Type"), "audio/mp4")
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, data, []byte{1, 2, 3})
+
+	url, _ = ms.Put("voice/my song #1?.m4a", "audio/mp4", []byte{4})
+	assert.Equal(t, url, "https://example.com/media/voice/my%20song%20%231%3F.m4a")
+	res, e = http.Get(server.URL + "/media/voice/my%20song%20%231%3F.m4a")
+	assert.Nil(t, e)
+	assert.Equal(t, res.StatusCode, 200)
+	res.Body.Close()
+
+	ms.Remove("voice/hello.m4a")
+	res, e = http.Get(server.URL + "/media/voice/hello.m4a")
+	assert.Nil(t, e)
+	assert.Equal(t, res.StatusCode, 404)
+}
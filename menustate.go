@@ -0,0 +1,189 @@
+package lbotx
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorUnknownMenuState = errors.New("Unknown menu state")
+)
+
+// MenuStateStore keeps the menu state currently linked to each user
+type MenuStateStore interface {
+	Get(userId string) (string, bool)
+	Set(userId, state string)
+	Delete(userId string)
+}
+
+type memoryMenuStateStore struct {
+	lock   sync.RWMutex
+	states map[string]string
+}
+
+func NewMemoryMenuStateStore() MenuStateStore {
+	return &memoryMenuStateStore{states: make(map[string]string)}
+}
+
+func (s *memoryMenuStateStore) Get(userId string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	state, ok := s.states[userId]
+	return state, ok
+}
+
+func (s *memoryMenuStateStore) Set(userId, state string) {
+	s.lock.Lock()
+	s.states[userId] = state
+	s.lock.Unlock()
+}
+
+func (s *memoryMenuStateStore) Delete(userId string) {
+	s.lock.Lock()
+	delete(s.states, userId)
+	s.lock.Unlock()
+}
+
+type menuTarget struct {
+	richMenuId string
+	alias      string
+}
+
+// MenuStates maps named user states to rich menus. The empty state is the default rich menu
+type MenuStates struct {
+	Store MenuStateStore
+
+	lock    sync.RWMutex
+	targets map[string]menuTarget
+}
+
+// MenuStates enables rich menu switching by user state with an in-memory store
+func (b *Bot) MenuStates() *MenuStates {
+	if b.menuStates == nil {
+		b.menuStates = &MenuStates{
+			Store:   NewMemoryMenuStateStore(),
+			targets: make(map[string]menuTarget),
+		}
+	}
+	return b.menuStates
+}
+
+func (ms *MenuStates) Map(state, richMenuId string) *MenuStates {
+	ms.lock.Lock()
+	ms.targets[state] = menuTarget{richMenuId: richMenuId}
+	ms.lock.Unlock()
+	return ms
+}
+
+// MapAlias maps the state to the rich menu the alias points to when the state is set
+func (ms *MenuStates) MapAlias(state, alias string) *MenuStates {
+	ms.lock.Lock()
+	ms.targets[state] = menuTarget{alias: alias}
+	ms.lock.Unlock()
+	return ms
+}
+
+func (ms *MenuStates) target(state string) (menuTarget, bool) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	target, ok := ms.targets[state]
+	return target, ok
+}
+
+// onEvent restores the default menu when a user linked to another one follows again. Users
+// on the default menu are forgotten when they unfollow
+func (ms *MenuStates) onEvent(context *BotContext) error {
+	userId := context.GetUserId()
+	if userId == "" {
+		return nil
+	}
+
+	state, ok := ms.Store.Get(userId)
+	if !ok || state == "" {
+		if context.Event.Type == linebot.EventTypeUnfollow {
+			ms.Store.Delete(userId)
+		}
+		return nil
+	}
+
+	if context.Event.Type == linebot.EventTypeFollow {
+		return context.ResetMenuState()
+	}
+	return nil
+}
+
+// SetMenuState links the rich menu mapped to state to the user. Nothing is sent to LINE
+// when the user is already in that state
+func (c *BotContext) SetMenuState(state string) error {
+	if c.menuStates == nil {
+		return ErrorUnknownMenuState
+	}
+
+	if state == "" {
+		return c.ResetMenuState()
+	}
+
+	target, ok := c.menuStates.target(state)
+	if !ok {
+		return ErrorUnknownMenuState
+	}
+
+	userId := c.GetUserId()
+	if userId == "" {
+		return ErrorInvalidUserId
+	}
+
+	if current, ok := c.menuStates.Store.Get(userId); ok && current == state {
+		return nil
+	}
+
+	var e error
+	if target.alias != "" {
+		e = c.LinkRichMenuAlias(target.alias)
+	} else {
+		e = c.LinkRichMenu(target.richMenuId)
+	}
+	if e != nil {
+		return e
+	}
+
+	c.menuStates.Store.Set(userId, state)
+	return nil
+}
+
+// MenuState returns the state set for the user, "" when the user has the default menu
+func (c *BotContext) MenuState() string {
+	if c.menuStates == nil {
+		return ""
+	}
+
+	state, _ := c.menuStates.Store.Get(c.GetUserId())
+	return state
+}
+
+// ResetMenuState unlinks the user's rich menu so the default one is shown again
+func (c *BotContext) ResetMenuState() error {
+	if c.menuStates == nil {
+		return ErrorUnknownMenuState
+	}
+
+	userId := c.GetUserId()
+	if userId == "" {
+		return ErrorInvalidUserId
+	}
+
+	if current, ok := c.menuStates.Store.Get(userId); ok && current == "" {
+		return nil
+	}
+
+	if e := c.UnlinkRichMenu(); e != nil {
+		return e
+	}
+
+	c.menuStates.Store.Set(userId, "")
+	return nil
+}
@@ -0,0 +1,84 @@
+package lbotx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMenuStates(t *testing.T) {
+	lock := sync.Mutex{}
+	calls := []string{}
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		calls = append(calls, req.Method+" "+req.URL.Path)
+		lock.Unlock()
+
+		if strings.Contains(req.URL.Path, "alias") {
+			w.WriteHeader(200)
+			w.Write([]byte(`{"richMenuAliasId":"checkout","richMenuId":"richmenu-checkout"}`))
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	client, _ := mockClient(mockServer)
+	bot, _ := NewBot("test", "test")
+	bot.Client = client
+
+	bot.MenuStates().
+		Map("loggedIn", "richmenu-member").
+		MapAlias("checkout", "checkout")
+
+	event := &linebot.Event{
+		Type: linebot.EventTypeMessage,
+		Source: &linebot.EventSource{
+			Type:   linebot.EventSourceTypeUser,
+			UserID: "u206d25c2ea6bd87c17655609a1c37cb8",
+		},
+	}
+	context := bot.NewContext(event)
+
+	assert.Equal(t, context.MenuState(), "")
+	assert.Nil(t, context.SetMenuState("loggedIn"))
+	assert.Nil(t, context.SetMenuState("loggedIn"))
+	assert.Equal(t, context.MenuState(), "loggedIn")
+	assert.Equal(t, calls, []string{"POST /v2/bot/user/u206d25c2ea6bd87c17655609a1c37cb8/richmenu/richmenu-member"})
+
+	calls = []string{}
+	assert.Nil(t, context.SetMenuState("checkout"))
+	assert.Equal(t, calls, []string{
+		"GET /v2/bot/richmenu/alias/checkout",
+		"POST /v2/bot/user/u206d25c2ea6bd87c17655609a1c37cb8/richmenu/richmenu-checkout",
+	})
+
+	assert.Equal(t, context.SetMenuState("unknown"), ErrorUnknownMenuState)
+	assert.Equal(t, context.MenuState(), "checkout")
+
+	//Unfollow and follow again restores the default menu
+	calls = []string{}
+	event.Type = linebot.EventTypeUnfollow
+	assert.Nil(t, bot.menuStates.onEvent(bot.NewContext(event)))
+	event.Type = linebot.EventTypeFollow
+	assert.Nil(t, bot.menuStates.onEvent(bot.NewContext(event)))
+	assert.Nil(t, context.ResetMenuState())
+	assert.Equal(t, context.MenuState(), "")
+	assert.Equal(t, calls, []string{"DELETE /v2/bot/user/u206d25c2ea6bd87c17655609a1c37cb8/richmenu"})
+
+	//New followers are on the default menu already
+	calls = []string{}
+	event.Source.UserID = "U2"
+	assert.Nil(t, bot.menuStates.onEvent(bot.NewContext(event)))
+	assert.Equal(t, calls, []string{})
+
+	//Without MenuStates there is nothing to switch
+	bot, _ = NewBot("test", "test")
+	assert.Equal(t, bot.NewContext(event).SetMenuState("loggedIn"), ErrorUnknownMenuState)
+}
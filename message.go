@@ -2,7 +2,9 @@ package lbotx
 
 import (
 	"errors"
+	"sync"
 	"text/template"
+	"time"
 
 	"net/url"
 
@@ -12,8 +14,10 @@ import (
 )
 
 type MessageBank struct {
-	messages []linebot.Message
-	bot      *linebot.Client
+	messages  []linebot.Message
+	templates []MessageTemplate //Rendered per recipient by PostMan, after messages
+	bot       *linebot.Client
+	quota     *QuotaTracker //Checks pushes only, replies are free
 }
 
 var (
@@ -27,11 +31,13 @@ var (
 	ErrorTooManyColumn          = errors.New("Too many columns")
 	ErrorActionNumNotConsistent = errors.New("Number of actions is not consistent in each column")
 	ErrorNoColumnTemplate       = errors.New("You did not setup column template first")
+	ErrorAreaOutOfBounds        = errors.New("Image map area is out of the base size")
+	ErrorAreaOverlap            = errors.New("Image map areas overlap each other")
 )
 
 func (mb *MessageBank) AddMessage(m linebot.Message) error {
 	if mb != nil {
-		if len(mb.messages) > 5 {
+		if len(mb.messages)+len(mb.templates) >= 5 {
 			return ErrorTooManyMessages
 		}
 		mb.messages = append(mb.messages, m)
@@ -75,43 +81,113 @@ func (mb *MessageBank) Len() int {
 
 func (mb *MessageBank) reply(reply_token string) error {
 	if len(mb.messages) > 0 {
-		if _, err := mb.bot.ReplyMessage(reply_token, mb.messages...).Do(); err != nil {
-			return err
+		ctx, info := apiCall("")
+		if _, err := mb.bot.ReplyMessage(reply_token, mb.messages...).WithContext(ctx).Do(); err != nil {
+			return wrapAPIError(err, info)
 		}
 	}
 	return nil
 }
 
-func (mb *MessageBank) push(to string) error {
-	if _, err := mb.bot.PushMessage(to, mb.messages...).Do(); err != nil {
+// metered sends within the quota, when there is one. LINE counts a request once per
+// recipient, whatever the number of messages in it
+func (mb *MessageBank) metered(n int64, send func() error) error {
+	if mb.quota == nil {
+		return send()
+	}
+
+	if err := mb.quota.reserve(n); err != nil {
 		return err
 	}
-	return nil
+	err := send()
+	if err != nil {
+		mb.quota.release(n)
+	} else if n == 0 {
+		mb.quota.invalidate() //Counted by LINE only
+	}
+	return err
 }
 
-type PostMan struct {
-	MessageBank
+func (mb *MessageBank) push(to, retryKey string) error {
+	return mb.pushMessages(to, retryKey, mb.messages)
 }
 
-func (pm *PostMan) SendImmediately(tos ...string) ([]string, error) {
-	success := []string{}
-	var err error = nil
+func (mb *MessageBank) pushMessages(to, retryKey string, messages []linebot.Message) error {
+	return mb.metered(1, func() error {
+		ctx, info := apiCall(retryKey)
+		if _, err := mb.bot.PushMessage(to, messages...).WithContext(ctx).Do(); err != nil {
+			return wrapAPIError(err, info)
+		}
+		return nil
+	})
+}
 
-	for _, to := range tos {
-		err = pm.push(to)
+func (mb *MessageBank) multicast(tos []string, retryKey string) error {
+	return mb.metered(int64(len(tos)), func() error {
+		ctx, info := apiCall(retryKey)
+		if _, err := mb.bot.Multicast(tos, mb.messages...).WithContext(ctx).Do(); err != nil {
+			return wrapAPIError(err, info)
+		}
+		return nil
+	})
+}
 
-		if err != nil {
-			break
-		} else {
-			success = append(success, to)
+func (mb *MessageBank) broadcast(retryKey string) error {
+	return mb.metered(0, func() error {
+		ctx, info := apiCall(retryKey)
+		if _, err := mb.bot.BroadcastMessage(mb.messages...).WithContext(ctx).Do(); err != nil {
+			return wrapAPIError(err, info)
 		}
-	}
+		return nil
+	})
+}
+
+type PostMan struct {
+	MessageBank
+
+	// Retry applies to each recipient. The zero value tries once
+	Retry RetryPolicy
+	// ContinueOnError keeps sending to the other recipients when one fails
+	ContinueOnError bool
+	// MulticastConcurrency is how many multicast requests run at once, MulticastInterval
+	// the least time between starting two of them
+	MulticastConcurrency int
+	MulticastInterval    time.Duration
+
+	// Attributes are given to templates added with AddTemplate
+	Attributes UserAttributeStore
 
-	if err == nil {
-		//flush all messages
-		pm.messages = []linebot.Message{}
+	outcomesLock sync.Mutex
+	outcomes     map[string]PushOutcome
+	sleep        func(d time.Duration)
+}
+
+// NewPostMan creates a PostMan retrying with DefaultRetryPolicy
+func (b *Bot) NewPostMan() *PostMan {
+	return &PostMan{
+		MessageBank:          MessageBank{bot: b.Client, quota: b.quota},
+		Retry:                DefaultRetryPolicy,
+		MulticastConcurrency: 4,
+		MulticastInterval:    5 * time.Millisecond, //LINE allows 200 multicasts per second
 	}
-	return success, err
+}
+
+func (pm *PostMan) WithRetryPolicy(policy RetryPolicy) *PostMan {
+	pm.Retry = policy
+	return pm
+}
+
+// WithQuota checks pushes against q instead of the quota of the bot, nil for none
+func (pm *PostMan) WithQuota(q *QuotaTracker) *PostMan {
+	pm.quota = q
+	return pm
+}
+
+// SendImmediately pushes to tos in order and stops at the first failure. It returns the
+// recipients reached, see Send for a full report
+func (pm *PostMan) SendImmediately(tos ...string) ([]string, error) {
+	report := pm.Send(tos...)
+	return report.Delivered(), report.Err()
 }
 
 func validateActionTexts(iaction interface{}) error {
@@ -152,6 +228,8 @@ func validateActionTexts(iaction interface{}) error {
 
 type ImageMapBuilder struct {
 	actions []linebot.ImagemapAction
+	layouts []*imageMapLayoutAction
+	video   *linebot.ImagemapVideo
 	BaseUrl string
 	AltText string
 	Width   int
@@ -192,7 +270,7 @@ func (ib *ImageMapBuilder) WithURIAction(linkURL string, x, y, width, height int
 }
 
 func (ib *ImageMapBuilder) Build() (linebot.Message, error) {
-	if ib.actions == nil || len(ib.actions) == 0 {
+	if len(ib.actions) == 0 && len(ib.layouts) == 0 {
 		return nil, ErrorNoAction
 	}
 
@@ -200,7 +278,20 @@ func (ib *ImageMapBuilder) Build() (linebot.Message, error) {
 		return nil, ErrorInvalidMapSize
 	}
 
-	for _, action := range ib.actions {
+	actions := make([]linebot.ImagemapAction, 0, len(ib.actions)+len(ib.layouts))
+	layouts := ib.layouts
+	for i := 0; i <= len(ib.actions); i++ {
+		for len(layouts) > 0 && layouts[0].before == i {
+			actions = append(actions, layouts[0].resolve(ib.Width, ib.Height))
+			layouts = layouts[1:]
+		}
+		if i < len(ib.actions) {
+			actions = append(actions, ib.actions[i])
+		}
+	}
+
+	areas := []linebot.ImagemapArea{}
+	for _, action := range actions {
 		var area linebot.ImagemapArea
 		switch act := action.(type) {
 		case *linebot.MessageImagemapAction:
@@ -213,12 +304,41 @@ func (ib *ImageMapBuilder) Build() (linebot.Message, error) {
 			return nil, ErrorInvalidMapSize
 		}
 
+		if !ib.contains(area) {
+			return nil, ErrorAreaOutOfBounds
+		}
+
+		for _, other := range areas {
+			if areaOverlaps(area, other) {
+				return nil, ErrorAreaOverlap
+			}
+		}
+		areas = append(areas, area)
+
 		if e := validateActionTexts(action); e != nil {
 			return nil, e
 		}
 	}
 
-	return linebot.NewImagemapMessage(ib.BaseUrl, ib.AltText, linebot.ImagemapBaseSize{ib.Width, ib.Height}, ib.actions...), nil
+	msg := linebot.NewImagemapMessage(ib.BaseUrl, ib.AltText, linebot.ImagemapBaseSize{ib.Width, ib.Height}, actions...)
+
+	if ib.video != nil {
+		if ib.video.Area.Width == 0 || ib.video.Area.Height == 0 {
+			return nil, ErrorInvalidMapSize
+		}
+
+		if !ib.contains(ib.video.Area) {
+			return nil, ErrorAreaOutOfBounds
+		}
+
+		if ib.video.ExternalLink != nil && len([]rune(ib.video.ExternalLink.Label)) > 30 {
+			return nil, ErrorTextExceedLimit
+		}
+
+		msg.WithVideo(ib.video)
+	}
+
+	return msg, nil
 }
 
 type iactionable interface {
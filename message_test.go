@@ -170,18 +170,19 @@ func TestImageMap(t *testing.T) {
 	b.Width = 400
 	b.Height = 400
 	b.WithMessageAction("test", 10, 10, 30, 30)
-	b.WithURIAction("https://www.google.com", 30, 30, 40, 40)
+	b.WithURIAction("https://www.google.com", 40, 40, 40, 40)
 
-	message, _ := b.Build()
+	message, e := b.Build()
+	assert.Nil(t, e)
 
 	b = NewImageMapBuilderWith("https://upload.wikimedia.org/wikipedia/commons/c/c4/Leaky_bucket_analogy.JPG", "altText", 400, 400)
 	b.WithMessageAction("test", 10, 10, 30, 30)
-	b.WithURIAction("https://www.google.com", 30, 30, 40, 40)
+	b.WithURIAction("https://www.google.com", 40, 40, 40, 40)
 
 	message2, _ := b.Build()
 
 	action1 := linebot.NewMessageImagemapAction("test", linebot.ImagemapArea{10, 10, 30, 30})
-	action2 := linebot.NewURIImagemapAction("https://www.google.com", linebot.ImagemapArea{30, 30, 40, 40})
+	action2 := linebot.NewURIImagemapAction("https://www.google.com", linebot.ImagemapArea{40, 40, 40, 40})
 	message3 := linebot.NewImagemapMessage("https://upload.wikimedia.org/wikipedia/commons/c/c4/Leaky_bucket_analogy.JPG", "altText", linebot.ImagemapBaseSize{400, 400}, action1, action2)
 
 	assert.Equal(t, message, message2)
@@ -0,0 +1,224 @@
+package lbotx
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorModuleMounted   = errors.New("Module is already mounted")
+	ErrorModuleName      = errors.New("Module has no name")
+	ErrorDuplicateModule = errors.New("A module with this name is already mounted")
+)
+
+type CommandHandler func(context *BotContext, args []string) (bool, error)
+type PostbackRouteHandler func(context *BotContext, params url.Values) (bool, error)
+
+// Module groups handlers, middleware, commands and postback routes of a feature. It runs as
+// one handler in the chain of the bot it is mounted to and can be switched off per group,
+// room or user at runtime
+type Module struct {
+	*Router
+	Name string
+
+	prefix   string
+	mounted  bool
+	handlers handlerTable
+
+	lock      sync.RWMutex
+	disabled  bool
+	overrides map[string]bool
+}
+
+func NewModule(name string) *Module {
+	m := &Module{
+		Name:      name,
+		overrides: make(map[string]bool),
+	}
+	m.Router = &Router{table: &m.handlers}
+	return m
+}
+
+// Mount adds the module to the handler chain. Commands of the module become
+// "/prefix name args..." and postback routes "prefix/route?params"
+func (r *Router) Mount(prefix string, m *Module) error {
+	if m.mounted {
+		return ErrorModuleMounted
+	}
+	if m.Name == "" {
+		return ErrorModuleName
+	}
+
+	named, e := r.Named("module:"+m.Name, 0)
+	if e != nil {
+		return ErrorDuplicateModule
+	}
+
+	m.mounted = true
+	m.prefix = strings.Trim(prefix, "/ ")
+	m.Router.bot = r.root().bot
+	named.add(handlerEntry{key: anyEvent, module: m}, m.dispatch)
+	return nil
+}
+
+func (m *Module) Prefix() string {
+	return m.prefix
+}
+
+func (m *Module) dispatch(context *BotContext) (bool, error) {
+	if !m.IsEnabled(context) {
+		return true, nil //Module is off here. Continue.
+	}
+
+	for _, handler := range m.handlers.lookup(context.Event) {
+		next, e := handler(context)
+		if !next || e != nil {
+			return next, e
+		}
+	}
+
+	return true, nil
+}
+
+// SetEnabled switches the module on or off everywhere without per id overrides
+func (m *Module) SetEnabled(enabled bool) {
+	m.lock.Lock()
+	m.disabled = !enabled
+	m.lock.Unlock()
+}
+
+// EnableFor switches the module on for group, room or user ids
+func (m *Module) EnableFor(ids ...string) {
+	m.setOverride(true, ids)
+}
+
+// DisableFor switches the module off for group, room or user ids
+func (m *Module) DisableFor(ids ...string) {
+	m.setOverride(false, ids)
+}
+
+// ResetFor removes overrides of ids so they follow SetEnabled again
+func (m *Module) ResetFor(ids ...string) {
+	m.lock.Lock()
+	for _, id := range ids {
+		delete(m.overrides, id)
+	}
+	m.lock.Unlock()
+}
+
+func (m *Module) setOverride(enabled bool, ids []string) {
+	m.lock.Lock()
+	for _, id := range ids {
+		m.overrides[id] = enabled
+	}
+	m.lock.Unlock()
+}
+
+// IsEnabled checks overrides of the group or room first, then of the user
+func (m *Module) IsEnabled(context *BotContext) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	source := context.Event.Source
+	if source != nil {
+		for _, id := range []string{source.GroupID, source.RoomID, source.UserID} {
+			if id == "" {
+				continue
+			}
+			if enabled, ok := m.overrides[id]; ok {
+				return enabled
+			}
+		}
+	}
+
+	return !m.disabled
+}
+
+// enabledFor is IsEnabled, or whether the module is on everywhere without context
+func (m *Module) enabledFor(context *BotContext) bool {
+	if context != nil {
+		return m.IsEnabled(context)
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return !m.disabled
+}
+
+// OnCommand handles text commands of the module, "/prefix name args..." or "/name args..."
+// when mounted without prefix
+func (m *Module) OnCommand(name string, handler CommandHandler) {
+	entry := handlerEntry{key: dispatchKey{linebot.EventTypeMessage, textMessageType}, command: name}
+	m.add(entry, textHandler(func(context *BotContext, text string) (bool, error) {
+		fields := strings.Fields(text)
+
+		if m.prefix != "" {
+			if len(fields) < 2 || fields[0] != "/"+m.prefix || fields[1] != name {
+				return true, nil
+			}
+			return handler(context, fields[2:])
+		}
+
+		if len(fields) < 1 || fields[0] != "/"+name {
+			return true, nil
+		}
+		return handler(context, fields[1:])
+	}))
+}
+
+// command is the text starting a command, without args
+func (m *Module) command(name string) string {
+	if m.prefix != "" {
+		return "/" + m.prefix + " " + name
+	}
+	return "/" + name
+}
+
+// PostbackData builds postback data for a route of the module
+func (m *Module) PostbackData(route string, params url.Values) string {
+	data := route
+	if m.prefix != "" {
+		data = m.prefix + "/" + route
+	}
+
+	if len(params) > 0 {
+		data += "?" + params.Encode()
+	}
+	return data
+}
+
+func (m *Module) OnPostbackRoute(route string, handler PostbackRouteHandler) {
+	m.on(dispatchKey{eventType: linebot.EventTypePostback}, func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypePostback || context.Event.Postback == nil {
+			return true, nil
+		}
+
+		data := context.Event.Postback.Data
+		if m.prefix != "" {
+			if !strings.HasPrefix(data, m.prefix+"/") {
+				return true, nil
+			}
+			data = data[len(m.prefix)+1:]
+		}
+
+		path, query := data, ""
+		if idx := strings.Index(data, "?"); idx >= 0 {
+			path, query = data[:idx], data[idx+1:]
+		}
+
+		if path != route {
+			return true, nil
+		}
+
+		params, e := url.ParseQuery(query)
+		if e != nil {
+			return false, e
+		}
+
+		return handler(context, params)
+	})
+}
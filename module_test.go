@@ -0,0 +1,73 @@
+package lbotx
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModule(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	trace := []string{}
+	shop := NewModule("shop")
+	shop.Use(func(next EventHandler) EventHandler {
+		return func(context *BotContext) (bool, error) {
+			trace = append(trace, "shop middleware")
+			return next(context)
+		}
+	})
+	shop.OnCommand("buy", func(context *BotContext, args []string) (bool, error) {
+		trace = append(trace, "buy "+args[0])
+		return false, nil
+	})
+	shop.OnPostbackRoute("cart/add", func(context *BotContext, params url.Values) (bool, error) {
+		trace = append(trace, "add "+params.Get("item"))
+		return false, nil
+	})
+
+	assert.Nil(t, bot.Mount("shop", shop))
+	assert.Equal(t, bot.Mount("other", shop), ErrorModuleMounted)
+	assert.Equal(t, len(bot.table.handlers()), 1)
+
+	//Module names are unique
+	assert.Equal(t, bot.Mount("shop2", NewModule("shop")), ErrorDuplicateModule)
+	assert.Equal(t, bot.Mount("nameless", NewModule("")), ErrorModuleName)
+	assert.Equal(t, len(bot.table.handlers()), 1)
+
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "fallback "+text)
+		return false, nil
+	})
+
+	group := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C1", UserID: "U1"}
+	dispatch(bot, textEvent(group, "/shop buy apple"))
+	dispatch(bot, textEvent(group, "/buy apple"))
+	assert.Equal(t, trace, []string{"shop middleware", "buy apple", "shop middleware", "fallback /buy apple"})
+
+	data := shop.PostbackData("cart/add", url.Values{"item": {"apple"}})
+	assert.Equal(t, data, "shop/cart/add?item=apple")
+
+	trace = []string{}
+	dispatch(bot, &linebot.Event{Type: linebot.EventTypePostback, Source: group, Postback: &linebot.Postback{Data: data}})
+	dispatch(bot, &linebot.Event{Type: linebot.EventTypePostback, Source: group, Postback: &linebot.Postback{Data: "cart/add?item=apple"}})
+	assert.Equal(t, trace, []string{"shop middleware", "add apple", "shop middleware"})
+
+	//Disabled in group C1, but enabled for others
+	trace = []string{}
+	shop.DisableFor("C1")
+	dispatch(bot, textEvent(group, "/shop buy apple"))
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "/shop buy pear"))
+	assert.Equal(t, trace, []string{"fallback /shop buy apple", "shop middleware", "buy pear"})
+
+	//Disabled everywhere except user U2
+	trace = []string{}
+	shop.ResetFor("C1")
+	shop.SetEnabled(false)
+	shop.EnableFor("U2")
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "/shop buy pear"))
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U2"}, "/shop buy pear"))
+	assert.Equal(t, trace, []string{"fallback /shop buy pear", "shop middleware", "buy pear"})
+}
@@ -0,0 +1,396 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorUnknownJob = errors.New("No outbox job with this id")
+)
+
+// OutboxJob is a push of Messages waiting to be delivered. To only keeps the recipients
+// who have not got the messages yet. Each of them keeps one retry key for the whole life
+// of the job, so sending again after a restart never delivers twice
+type OutboxJob struct {
+	ID        string            `json:"id"`
+	To        []string          `json:"to"`
+	Messages  []json.RawMessage `json:"messages"`
+	RetryKeys map[string]string `json:"retryKeys"`
+	Attempts  int               `json:"attempts"`
+	Dead      bool              `json:"dead"`
+	Reason    string            `json:"reason,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// OutboxStore keeps outbox jobs. Save adds or replaces a job, Jobs returns every job,
+// dead ones included, in the order they were first saved
+type OutboxStore interface {
+	Save(job OutboxJob) error
+	Delete(id string) error
+	Jobs() ([]OutboxJob, error)
+}
+
+type memoryOutboxStore struct {
+	lock  sync.Mutex
+	jobs  map[string]OutboxJob
+	order []string
+}
+
+// NewMemoryOutboxStore creates a store which doesn't survive restarts, for tests
+func NewMemoryOutboxStore() OutboxStore {
+	return &memoryOutboxStore{jobs: make(map[string]OutboxJob)}
+}
+
+func (s *memoryOutboxStore) Save(job OutboxJob) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.jobs[job.ID]; !ok {
+		s.order = append(s.order, job.ID)
+	}
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *memoryOutboxStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return nil
+	}
+
+	delete(s.jobs, id)
+	for i, jobId := range s.order {
+		if jobId == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryOutboxStore) Jobs() ([]OutboxJob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs := []OutboxJob{}
+	for _, id := range s.order {
+		jobs = append(jobs, s.jobs[id])
+	}
+	return jobs, nil
+}
+
+type outboxRecord struct {
+	Op  string     `json:"op"`
+	Job *OutboxJob `json:"job,omitempty"`
+	ID  string     `json:"id,omitempty"`
+}
+
+// FileOutboxStore appends every change to a file, one json record per line, and replays
+// the file when opened. Compact rewrites the file with the jobs left
+type FileOutboxStore struct {
+	*jsonLog
+	jobs *memoryOutboxStore
+}
+
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	s := &FileOutboxStore{
+		jobs: &memoryOutboxStore{jobs: make(map[string]OutboxJob)},
+	}
+
+	log, e := openJSONLog(path, func(line []byte) error {
+		record := outboxRecord{}
+		if e := json.Unmarshal(line, &record); e != nil {
+			return e
+		}
+
+		switch record.Op {
+		case "save":
+			if record.Job == nil {
+				return nil //Broken record, dropped like a cut line
+			}
+			s.jobs.Save(*record.Job)
+		case "delete":
+			s.jobs.Delete(record.ID)
+		}
+		return nil
+	}, s.records)
+	if e != nil {
+		return nil, e
+	}
+	s.jsonLog = log
+
+	return s, nil
+}
+
+func (s *FileOutboxStore) Save(job OutboxJob) error {
+	return s.write(outboxRecord{Op: "save", Job: &job}, func() error {
+		return s.jobs.Save(job)
+	})
+}
+
+func (s *FileOutboxStore) Delete(id string) error {
+	return s.write(outboxRecord{Op: "delete", ID: id}, func() error {
+		return s.jobs.Delete(id)
+	})
+}
+
+func (s *FileOutboxStore) Jobs() ([]OutboxJob, error) {
+	return s.jobs.Jobs()
+}
+
+// records are the jobs left, without their history
+func (s *FileOutboxStore) records() []interface{} {
+	jobs, _ := s.jobs.Jobs()
+
+	records := []interface{}{}
+	for i := range jobs {
+		records = append(records, outboxRecord{Op: "save", Job: &jobs[i]})
+	}
+	return records
+}
+
+// rawMessage sends a message stored as json as it is
+type rawMessage json.RawMessage
+
+func (m rawMessage) MarshalJSON() ([]byte, error) {
+	return m, nil
+}
+
+func (m rawMessage) Message() {}
+
+func (m rawMessage) Type() linebot.MessageType {
+	message := struct {
+		Type linebot.MessageType `json:"type"`
+	}{}
+	json.Unmarshal(m, &message)
+	return message.Type
+}
+
+func (m rawMessage) with(key string, value interface{}) rawMessage {
+	fields := map[string]interface{}{}
+	json.Unmarshal(m, &fields)
+	fields[key] = value
+
+	data, _ := json.Marshal(fields)
+	return rawMessage(data)
+}
+
+func (m rawMessage) WithQuickReplies(items *linebot.QuickReplyItems) linebot.Message {
+	return m.with("quickReply", items)
+}
+
+func (m rawMessage) WithSender(sender *linebot.Sender) linebot.Message {
+	return m.with("sender", sender)
+}
+
+func (m rawMessage) AddEmoji(emoji *linebot.Emoji) linebot.Message {
+	fields := struct {
+		Emojis []json.RawMessage `json:"emojis"`
+	}{}
+	json.Unmarshal(m, &fields)
+
+	data, _ := json.Marshal(emoji)
+	return m.with("emojis", append(fields.Emojis, data))
+}
+
+// Outbox pushes messages through a durable store, so pushes survive restarts. Jobs failing
+// with errors that can't be retried, or MaxAttempts times, become dead letters
+type Outbox struct {
+	Store OutboxStore
+	// Retry applies within one delivery of a job
+	Retry       RetryPolicy
+	MaxAttempts int
+
+	bot   *Bot
+	lock  sync.Mutex
+	sleep func(d time.Duration)
+}
+
+func (b *Bot) NewOutbox(store OutboxStore) *Outbox {
+	return &Outbox{
+		Store:       store,
+		Retry:       DefaultRetryPolicy,
+		MaxAttempts: 5,
+		bot:         b,
+	}
+}
+
+// Enqueue stores a job pushing messages to tos and returns its id. Call Deliver, or Start,
+// to send it
+func (o *Outbox) Enqueue(tos []string, messages ...linebot.Message) (string, error) {
+	job := OutboxJob{
+		ID:        newRetryKey(),
+		To:        tos,
+		RetryKeys: make(map[string]string),
+		CreatedAt: time.Now(),
+	}
+
+	for _, to := range tos {
+		job.RetryKeys[to] = newRetryKey()
+	}
+
+	for _, message := range messages {
+		data, e := json.Marshal(message)
+		if e != nil {
+			return "", e
+		}
+		job.Messages = append(job.Messages, data)
+	}
+
+	return job.ID, o.Store.Save(job)
+}
+
+// Deliver sends every pending job once, oldest first, including jobs left by an earlier
+// run of the process. It returns errors of the store, delivery failures stay in the jobs
+func (o *Outbox) Deliver() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	jobs, e := o.Store.Jobs()
+	if e != nil {
+		return e
+	}
+
+	for _, job := range jobs {
+		if job.Dead {
+			continue
+		}
+
+		if e := o.deliver(job); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (o *Outbox) deliver(job OutboxJob) error {
+	pm := o.bot.NewPostMan().WithRetryPolicy(o.Retry)
+	pm.sleep = o.sleep
+	for _, message := range job.Messages {
+		pm.messages = append(pm.messages, rawMessage(message))
+	}
+
+	retryKeys := make(map[string]string)
+	for to, retryKey := range job.RetryKeys {
+		retryKeys[to] = retryKey
+	}
+	job.RetryKeys = retryKeys
+
+	job.Attempts++
+	pending, dead := []string{}, []string{}
+	deadReason := ""
+	for _, to := range job.To {
+		outcome := pm.withRetry(to, job.RetryKeys[to], func(retryKey string) error {
+			return pm.push(to, retryKey)
+		})
+		if outcome.Err == nil {
+			delete(job.RetryKeys, to)
+			continue
+		}
+
+		if IsRetryable(outcome.Err) {
+			pending = append(pending, to)
+			job.Reason = outcome.Err.Error()
+		} else {
+			dead = append(dead, to)
+			deadReason = outcome.Err.Error()
+		}
+	}
+
+	if len(dead) > 0 && len(pending) == 0 {
+		pending, job.Reason, job.Dead = dead, deadReason, true
+	} else if len(dead) > 0 {
+		//Recipients that can't be reached go to a dead job of their own, the others stay
+		deadJob := job
+		deadJob.ID = newRetryKey()
+		deadJob.To = dead
+		deadJob.RetryKeys = make(map[string]string)
+		deadJob.Dead = true
+		deadJob.Reason = deadReason
+		for _, to := range dead {
+			deadJob.RetryKeys[to] = job.RetryKeys[to]
+			delete(job.RetryKeys, to)
+		}
+		if e := o.Store.Save(deadJob); e != nil {
+			return e
+		}
+	}
+
+	if len(pending) == 0 {
+		return o.Store.Delete(job.ID)
+	}
+
+	job.To = pending
+	if job.Attempts >= o.MaxAttempts {
+		job.Dead = true
+	}
+	return o.Store.Save(job)
+}
+
+// DeadLetters returns jobs given up on, with the recipients left and the last failure
+func (o *Outbox) DeadLetters() ([]OutboxJob, error) {
+	jobs, e := o.Store.Jobs()
+	if e != nil {
+		return nil, e
+	}
+
+	dead := []OutboxJob{}
+	for _, job := range jobs {
+		if job.Dead {
+			dead = append(dead, job)
+		}
+	}
+	return dead, nil
+}
+
+// Requeue makes a dead job pending again with its attempts reset
+func (o *Outbox) Requeue(id string) error {
+	jobs, e := o.Store.Jobs()
+	if e != nil {
+		return e
+	}
+
+	for _, job := range jobs {
+		if job.ID == id {
+			job.Dead = false
+			job.Attempts = 0
+			job.Reason = ""
+			return o.Store.Save(job)
+		}
+	}
+	return ErrorUnknownJob
+}
+
+// Start delivers pending jobs now, replaying what was left by the last run, and then every
+// interval until stop is called
+func (o *Outbox) Start(interval time.Duration, onError func(e error)) (stop func()) {
+	done := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if e := o.Deliver(); e != nil && onError != nil {
+				onError(e)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,257 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawMessage(t *testing.T) {
+	message := linebot.NewTextMessage("hello")
+	data, _ := json.Marshal(message)
+
+	raw := rawMessage(data)
+	assert.Equal(t, raw.Type(), linebot.MessageTypeText)
+
+	marshaled, _ := json.Marshal(raw)
+	assert.Equal(t, string(marshaled), string(data))
+}
+
+func TestOutbox(t *testing.T) {
+	statuses := map[string]int{"U1": 200, "U2": 500, "U3": 400}
+	retryKeys := map[string][]string{}
+	texts := []string{}
+
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body := struct {
+			To       string `json:"to"`
+			Messages []struct {
+				Text string `json:"text"`
+			} `json:"messages"`
+		}{}
+		json.Unmarshal(data, &body)
+
+		retryKeys[body.To] = append(retryKeys[body.To], req.Header.Get("X-Line-Retry-Key"))
+		texts = append(texts, body.Messages[0].Text)
+
+		w.WriteHeader(statuses[body.To])
+		w.Write([]byte(`{"message":"failed"}`))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	dir, _ := ioutil.TempDir("", "outbox")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.log")
+
+	store, e := NewFileOutboxStore(path)
+	assert.Nil(t, e)
+
+	outbox := bot.NewOutbox(store)
+	outbox.Retry = NoRetry
+	id1, e := outbox.Enqueue([]string{"U1", "U2"}, linebot.NewTextMessage("hello"))
+	assert.Nil(t, e)
+	id2, _ := outbox.Enqueue([]string{"U3"}, linebot.NewTextMessage("bye"))
+	store.Close()
+
+	//Restart before sending
+	store, e = NewFileOutboxStore(path)
+	assert.Nil(t, e)
+	jobs, _ := store.Jobs()
+	assert.Equal(t, len(jobs), 2)
+	assert.Equal(t, jobs[0].ID, id1)
+	assert.Equal(t, jobs[1].ID, id2)
+
+	outbox = bot.NewOutbox(store)
+	outbox.Retry = NoRetry
+	assert.Nil(t, outbox.Deliver())
+	assert.Equal(t, texts, []string{"hello", "hello", "bye"})
+
+	jobs, _ = store.Jobs()
+	assert.Equal(t, jobs[0].To, []string{"U2"})
+	assert.Equal(t, jobs[0].Attempts, 1)
+	assert.False(t, jobs[0].Dead)
+	assert.True(t, jobs[1].Dead)
+
+	dead, _ := outbox.DeadLetters()
+	assert.Equal(t, len(dead), 1)
+	assert.Equal(t, dead[0].ID, id2)
+	assert.True(t, strings.Contains(dead[0].Reason, "400"))
+	store.Close()
+
+	//Restart again, U2 keeps its retry key
+	store, _ = NewFileOutboxStore(path)
+	outbox = bot.NewOutbox(store)
+	outbox.Retry = NoRetry
+	statuses["U2"] = 200
+	texts = []string{}
+	assert.Nil(t, outbox.Deliver())
+	assert.Equal(t, texts, []string{"hello"})
+	assert.Equal(t, retryKeys["U2"][0], retryKeys["U2"][1])
+	assert.NotEqual(t, retryKeys["U1"][0], retryKeys["U2"][0])
+
+	jobs, _ = store.Jobs()
+	assert.Equal(t, len(jobs), 1)
+
+	//Requeue the dead letter
+	statuses["U3"] = 200
+	assert.Equal(t, outbox.Requeue("unknown"), ErrorUnknownJob)
+	assert.Nil(t, outbox.Requeue(id2))
+	assert.Nil(t, outbox.Deliver())
+	assert.Equal(t, texts, []string{"hello", "bye"})
+
+	jobs, _ = store.Jobs()
+	assert.Equal(t, len(jobs), 0)
+
+	assert.Nil(t, store.Compact())
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, len(data), 0)
+
+	//A record cut by a crash is ignored
+	outbox.Enqueue([]string{"U4"}, linebot.NewTextMessage("cut"))
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	file.Write([]byte(`{"op":"delete","id":"`))
+	file.Close()
+	store.Close()
+
+	store, e = NewFileOutboxStore(path)
+	assert.Nil(t, e)
+	jobs, _ = store.Jobs()
+	assert.Equal(t, len(jobs), 1)
+
+	//and dropped, records written after it are read again
+	assert.Nil(t, store.Delete(jobs[0].ID))
+	store.Close()
+
+	store, e = NewFileOutboxStore(path)
+	assert.Nil(t, e)
+	jobs, _ = store.Jobs()
+	assert.Equal(t, len(jobs), 0)
+	store.Close()
+}
+
+func TestFileOutboxStoreCompact(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "outbox")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.log")
+
+	store, _ := NewFileOutboxStore(path)
+
+	//Jobs saved while compacting are kept
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 50; i++ {
+			store.Save(OutboxJob{ID: fmt.Sprint(i)})
+		}
+		done <- true
+	}()
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.Compact())
+	}
+	<-done
+	store.Close()
+
+	store, _ = NewFileOutboxStore(path)
+	defer store.Close()
+	jobs, _ := store.Jobs()
+	assert.Equal(t, len(jobs), 50)
+}
+
+func TestOutboxMaxAttempts(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(503)
+		w.Write([]byte(`{"message":"unavailable"}`))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	sleeps := 0
+	outbox := bot.NewOutbox(NewMemoryOutboxStore())
+	outbox.Retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Second}
+	outbox.MaxAttempts = 3
+	outbox.sleep = func(d time.Duration) {
+		sleeps++
+	}
+
+	id, _ := outbox.Enqueue([]string{"U1"}, linebot.NewTextMessage("hello"))
+	for i := 0; i < 3; i++ {
+		dead, _ := outbox.DeadLetters()
+		assert.Equal(t, len(dead), 0)
+		outbox.Deliver()
+	}
+
+	dead, _ := outbox.DeadLetters()
+	assert.Equal(t, len(dead), 1)
+	assert.Equal(t, dead[0].ID, id)
+	assert.Equal(t, dead[0].Attempts, 3)
+	assert.Equal(t, sleeps, 3)
+
+	//Dead jobs are not delivered
+	outbox.Deliver()
+	assert.Equal(t, sleeps, 3)
+}
+
+func TestOutboxPartialDeadLetter(t *testing.T) {
+	statuses := map[string]int{"BAD": 400, "U1": 500, "U2": 500}
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body := struct {
+			To string `json:"to"`
+		}{}
+		json.Unmarshal(data, &body)
+
+		w.WriteHeader(statuses[body.To])
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	outbox := bot.NewOutbox(NewMemoryOutboxStore())
+	outbox.Retry = NoRetry
+	id, _ := outbox.Enqueue([]string{"BAD", "U1", "U2"}, linebot.NewTextMessage("hello"))
+	assert.Nil(t, outbox.Deliver())
+
+	//BAD is a dead letter, U1 and U2 are still queued
+	dead, _ := outbox.DeadLetters()
+	assert.Equal(t, len(dead), 1)
+	assert.NotEqual(t, dead[0].ID, id)
+	assert.Equal(t, dead[0].To, []string{"BAD"})
+	assert.True(t, strings.Contains(dead[0].Reason, "400"))
+
+	statuses["U1"], statuses["U2"] = 200, 200
+	assert.Nil(t, outbox.Deliver())
+	jobs, _ := outbox.Store.Jobs()
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(t, jobs[0].ID, dead[0].ID)
+}
+
+func TestFileOutboxStoreBrokenRecord(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "outbox")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.log")
+
+	ioutil.WriteFile(path, []byte(`{"op":"save"}`+"\n"+`{"op":"save","job":{"id":"1"}}`+"\n"), 0600)
+	store, e := NewFileOutboxStore(path)
+	assert.Nil(t, e)
+	defer store.Close()
+
+	jobs, _ := store.Jobs()
+	assert.Equal(t, len(jobs), 1)
+}
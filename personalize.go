@@ -0,0 +1,185 @@
+package lbotx
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"text/template"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorNotPersonalizable = errors.New("Templates can only be sent to each recipient with Send")
+)
+
+// Recipient is the data templates are rendered with: the profile of the user, e.g.
+// {{.Name}} or {{.Language}}, and attributes from the user store, e.g. {{.Attributes.plan}}
+type Recipient struct {
+	UserProfile
+	Attributes map[string]interface{}
+}
+
+// UserAttributeStore gives custom attributes of users to templates
+type UserAttributeStore interface {
+	Attributes(userId string) (map[string]interface{}, error)
+}
+
+// MapAttributes is a UserAttributeStore of attributes by user id
+type MapAttributes map[string]map[string]interface{}
+
+func (m MapAttributes) Attributes(userId string) (map[string]interface{}, error) {
+	return m[userId], nil
+}
+
+// MessageTemplate renders a message for one recipient
+type MessageTemplate interface {
+	Render(recipient *Recipient) (linebot.Message, error)
+}
+
+// MessageTemplateFunc renders messages with a function
+type MessageTemplateFunc func(recipient *Recipient) (linebot.Message, error)
+
+func (f MessageTemplateFunc) Render(recipient *Recipient) (linebot.Message, error) {
+	return f(recipient)
+}
+
+func executeTemplate(templ *template.Template, data interface{}) (string, error) {
+	buf := bytes.NewBufferString("")
+	if e := templ.Execute(buf, data); e != nil {
+		return "", e
+	}
+	return buf.String(), nil
+}
+
+// TextTemplate renders a text message in the language of the recipient, its base language
+// ("zh" for "zh-Hant") or the default language
+type TextTemplate struct {
+	DefaultLanguage string
+	templates       map[string]*template.Template
+}
+
+// NewTextTemplate creates a template of text, e.g. "Hi {{.Name}}"
+func NewTextTemplate(text string) (*TextTemplate, error) {
+	templ, e := template.New("text").Parse(text)
+	if e != nil {
+		return nil, e
+	}
+
+	return &TextTemplate{templates: map[string]*template.Template{"": templ}}, nil
+}
+
+// WithLanguage renders text for recipients of language instead
+func (tt *TextTemplate) WithLanguage(language, text string) error {
+	templ, e := template.New("text-" + language).Parse(text)
+	if e != nil {
+		return e
+	}
+
+	tt.templates[language] = templ
+	return nil
+}
+
+func (tt *TextTemplate) localize(language string) *template.Template {
+	if templ, ok := tt.templates[language]; ok {
+		return templ
+	}
+	if idx := strings.Index(language, "-"); idx > 0 {
+		if templ, ok := tt.templates[language[:idx]]; ok {
+			return templ
+		}
+	}
+	if templ, ok := tt.templates[tt.DefaultLanguage]; ok {
+		return templ
+	}
+	return tt.templates[""]
+}
+
+func (tt *TextTemplate) Render(recipient *Recipient) (linebot.Message, error) {
+	text, e := executeTemplate(tt.localize(recipient.Language), recipient)
+	if e != nil {
+		return nil, e
+	}
+	return linebot.NewTextMessage(text), nil
+}
+
+// CarouselTemplate builds a carousel for each recipient, e.g. with columns generated from
+// their attributes. The alt text is a template too
+type CarouselTemplate struct {
+	altText *template.Template
+	build   func(b *CarouselMessageBuilder, recipient *Recipient) error
+}
+
+func NewCarouselTemplate(altText string, build func(b *CarouselMessageBuilder, recipient *Recipient) error) (*CarouselTemplate, error) {
+	templ, e := template.New("altText").Parse(altText)
+	if e != nil {
+		return nil, e
+	}
+
+	return &CarouselTemplate{altText: templ, build: build}, nil
+}
+
+func (ct *CarouselTemplate) Render(recipient *Recipient) (linebot.Message, error) {
+	b := NewCarouselMessageBuilder()
+	if e := ct.build(b, recipient); e != nil {
+		return nil, e
+	}
+
+	altText, e := executeTemplate(ct.altText, recipient)
+	if e != nil {
+		return nil, e
+	}
+	return b.Build(altText)
+}
+
+// AddTemplate adds a message rendered for each recipient by Send, after the messages added
+// with AddMessage. Recipients get the data of their profile and of Attributes
+func (pm *PostMan) AddTemplate(t MessageTemplate) error {
+	if len(pm.messages)+len(pm.templates) >= 5 {
+		return ErrorTooManyMessages
+	}
+	pm.templates = append(pm.templates, t)
+	return nil
+}
+
+func (pm *PostMan) WithAttributes(store UserAttributeStore) *PostMan {
+	pm.Attributes = store
+	return pm
+}
+
+// personalize returns the messages for to, rendering templates if any
+func (pm *PostMan) personalize(to string) ([]linebot.Message, error) {
+	if len(pm.templates) == 0 {
+		return pm.messages, nil
+	}
+
+	profile, e := fetchProfile(pm.bot, to)
+	if e != nil {
+		return nil, e
+	}
+
+	recipient := &Recipient{UserProfile: *profile}
+	if pm.Attributes != nil {
+		if recipient.Attributes, e = pm.Attributes.Attributes(to); e != nil {
+			return nil, e
+		}
+	}
+
+	messages := append([]linebot.Message{}, pm.messages...)
+	for _, t := range pm.templates {
+		message, e := t.Render(recipient)
+		if e != nil {
+			return nil, e
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func notPersonalizable(tos []string) *DeliveryReport {
+	report := &DeliveryReport{}
+	for _, to := range tos {
+		report.Results = append(report.Results, PushOutcome{To: to, Err: ErrorNotPersonalizable})
+	}
+	return report
+}
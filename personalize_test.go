@@ -0,0 +1,167 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalizedMessages(t *testing.T) {
+	profiles := map[string]string{
+		"U1": `{"userId":"U1","displayName":"John","language":"en"}`,
+		"U2": `{"userId":"U2","displayName":"Mary","language":"zh-TW"}`,
+	}
+
+	type pushed struct {
+		To       string `json:"to"`
+		Messages []struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			AltText  string `json:"altText"`
+			Template struct {
+				Columns []struct {
+					Text string `json:"text"`
+				} `json:"columns"`
+			} `json:"template"`
+		} `json:"messages"`
+	}
+	pushes := []pushed{}
+
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/v2/bot/profile/") {
+			profile, ok := profiles[strings.TrimPrefix(req.URL.Path, "/v2/bot/profile/")]
+			if !ok {
+				w.WriteHeader(404)
+				w.Write([]byte(`{"message":"Not found"}`))
+				return
+			}
+			w.WriteHeader(200)
+			w.Write([]byte(profile))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(req.Body)
+		body := pushed{}
+		json.Unmarshal(data, &body)
+		pushes = append(pushes, body)
+
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	greeting, _ := NewTextTemplate("Hi {{.Name}}, your plan is {{.Attributes.plan}}")
+	assert.Nil(t, greeting.WithLanguage("zh", "{{.Name}} 您好"))
+
+	recommend, _ := NewCarouselTemplate("Picked for {{.Name}}", func(b *CarouselMessageBuilder, recipient *Recipient) error {
+		g := b.GetColumnGenerator()
+		g.WithText("{{.}}")
+		g.WithMessageAction("Buy", "buy {{.}}")
+		return b.GenerateColumnsWith(recipient.Attributes["items"].([]interface{})...)
+	})
+
+	pm := bot.NewPostMan().WithRetryPolicy(NoRetry).WithContinueOnError(true).WithAttributes(MapAttributes{
+		"U1": {"plan": "gold", "items": []interface{}{"apple", "banana"}},
+		"U2": {"plan": "free", "items": []interface{}{"cherry"}},
+	})
+	pm.AddTextMessage("News")
+	assert.Nil(t, pm.AddTemplate(greeting))
+	assert.Nil(t, pm.AddTemplate(recommend))
+
+	assert.Equal(t, pm.Multicast("U1", "U2").Err(), ErrorNotPersonalizable)
+	assert.Equal(t, pm.Broadcast().Err(), ErrorNotPersonalizable)
+
+	report := pm.Send("U1", "U2", "U3")
+	assert.Equal(t, report.Delivered(), []string{"U1", "U2"})
+	assert.Equal(t, report.Failed(), []string{"U3"})
+	assert.Equal(t, len(pushes), 2)
+
+	john := pushes[0]
+	assert.Equal(t, john.To, "U1")
+	assert.Equal(t, len(john.Messages), 3)
+	assert.Equal(t, john.Messages[0].Text, "News")
+	assert.Equal(t, john.Messages[1].Text, "Hi John, your plan is gold")
+	assert.Equal(t, john.Messages[2].AltText, "Picked for John")
+	assert.Equal(t, len(john.Messages[2].Template.Columns), 2)
+	assert.Equal(t, john.Messages[2].Template.Columns[1].Text, "banana")
+
+	mary := pushes[1]
+	assert.Equal(t, mary.Messages[1].Text, "Mary 您好")
+	assert.Equal(t, len(mary.Messages[2].Template.Columns), 1)
+	assert.Equal(t, mary.Messages[2].Template.Columns[0].Text, "cherry")
+}
+
+func TestMessageTemplateFunc(t *testing.T) {
+	templ := MessageTemplateFunc(func(recipient *Recipient) (linebot.Message, error) {
+		return linebot.NewTextMessage(recipient.Id), nil
+	})
+
+	message, _ := templ.Render(&Recipient{UserProfile: UserProfile{Id: "U1"}})
+	assert.Equal(t, message, linebot.NewTextMessage("U1"))
+
+	pm := (&Bot{}).NewPostMan()
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, pm.AddTemplate(templ))
+	}
+	assert.Equal(t, pm.AddTemplate(templ), ErrorTooManyMessages)
+
+	//Templates count with messages
+	pm = (&Bot{}).NewPostMan()
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, pm.AddTemplate(templ))
+	}
+	assert.Nil(t, pm.AddTextMessage("hello"))
+	assert.Equal(t, pm.AddTextMessage("hello"), ErrorTooManyMessages)
+
+	mb := &MessageBank{}
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, mb.AddTextMessage("hello"))
+	}
+	assert.Equal(t, mb.AddTextMessage("hello"), ErrorTooManyMessages)
+}
+
+func TestPersonalizeRetry(t *testing.T) {
+	profileCalls := 0
+	pushes := 0
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/v2/bot/profile/") {
+			profileCalls++
+			if profileCalls == 1 {
+				w.WriteHeader(429)
+				w.Write([]byte(`{"message":"Too many requests"}`))
+				return
+			}
+			w.WriteHeader(200)
+			w.Write([]byte(`{"userId":"U1","displayName":"John","language":"en"}`))
+			return
+		}
+
+		pushes++
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	greeting, _ := NewTextTemplate("Hi {{.Name}}")
+	pm := bot.NewPostMan().WithRetryPolicy(RetryPolicy{MaxAttempts: 3})
+	pm.sleep = func(d time.Duration) {}
+	assert.Nil(t, pm.AddTemplate(greeting))
+
+	report := pm.Send("U1")
+	assert.Nil(t, report.Err())
+	assert.Equal(t, profileCalls, 2)
+	assert.Equal(t, pushes, 1)
+}
@@ -0,0 +1,170 @@
+package lbotx
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorInvalidTimeRange = errors.New("Invalid time range. Time should be in hh:mm")
+)
+
+// Predicate decides whether an event should reach the handlers registered with bot.When
+type Predicate func(context *BotContext) bool
+
+func And(predicates ...Predicate) Predicate {
+	return func(context *BotContext) bool {
+		for _, p := range predicates {
+			if !p(context) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func Or(predicates ...Predicate) Predicate {
+	return func(context *BotContext) bool {
+		for _, p := range predicates {
+			if p(context) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(predicate Predicate) Predicate {
+	return func(context *BotContext) bool {
+		return !predicate(context)
+	}
+}
+
+// FromUser matches events sent by the users, wherever they are
+func FromUser(userIds ...string) Predicate {
+	set := idSet(userIds)
+	return func(context *BotContext) bool {
+		return context.Event.Source != nil && set[context.Event.Source.UserID]
+	}
+}
+
+func fromSource(sourceType linebot.EventSourceType) Predicate {
+	return func(context *BotContext) bool {
+		source := context.Event.Source
+		return source != nil && source.Type == sourceType
+	}
+}
+
+// inSource matches events from the sources of ids only. No ids match nothing
+func inSource(sourceType linebot.EventSourceType, ids []string, id func(source *linebot.EventSource) string) Predicate {
+	set := idSet(ids)
+	return func(context *BotContext) bool {
+		source := context.Event.Source
+		return source != nil && source.Type == sourceType && set[id(source)]
+	}
+}
+
+func InUserChat() Predicate {
+	return fromSource(linebot.EventSourceTypeUser)
+}
+
+func InAnyGroup() Predicate {
+	return fromSource(linebot.EventSourceTypeGroup)
+}
+
+func InAnyRoom() Predicate {
+	return fromSource(linebot.EventSourceTypeRoom)
+}
+
+// InGroup matches events from the groups, see InAnyGroup for any group
+func InGroup(groupIds ...string) Predicate {
+	return inSource(linebot.EventSourceTypeGroup, groupIds, func(source *linebot.EventSource) string {
+		return source.GroupID
+	})
+}
+
+// InRoom matches events from the rooms, see InAnyRoom for any room
+func InRoom(roomIds ...string) Predicate {
+	return inSource(linebot.EventSourceTypeRoom, roomIds, func(source *linebot.EventSource) string {
+		return source.RoomID
+	})
+}
+
+// TextMatches matches text messages matching re
+func TextMatches(re *regexp.Regexp) Predicate {
+	return func(context *BotContext) bool {
+		if context.Event.Type != linebot.EventTypeMessage {
+			return false
+		}
+
+		msg, ok := context.Event.Message.(*linebot.TextMessage)
+		return ok && re.MatchString(msg.Text)
+	}
+}
+
+// HasSessionState matches users whose state set by SetMenuState is one of states. Nobody
+// matches without MenuStates
+func HasSessionState(states ...string) Predicate {
+	set := idSet(states)
+	return func(context *BotContext) bool {
+		return context.menuStates != nil && set[context.MenuState()]
+	}
+}
+
+// TimeRange is a daily period from From to To in Location. To before From spans midnight
+type TimeRange struct {
+	From     time.Duration
+	To       time.Duration
+	Location *time.Location
+}
+
+func parseClock(clock string) (time.Duration, error) {
+	t, e := time.Parse("15:04", clock)
+	if e != nil {
+		return 0, ErrorInvalidTimeRange
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// NewTimeRange creates a TimeRange from "hh:mm" clocks, e.g. NewTimeRange("22:00", "06:00", loc)
+func NewTimeRange(from, to string, location *time.Location) (TimeRange, error) {
+	tr := TimeRange{Location: location}
+
+	var e error
+	if tr.From, e = parseClock(from); e != nil {
+		return tr, e
+	}
+	if tr.To, e = parseClock(to); e != nil {
+		return tr, e
+	}
+
+	return tr, nil
+}
+
+func (tr TimeRange) Contains(t time.Time) bool {
+	if tr.Location != nil {
+		t = t.In(tr.Location)
+	}
+
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if tr.From <= tr.To {
+		return clock >= tr.From && clock < tr.To
+	}
+	return clock >= tr.From || clock < tr.To
+}
+
+// During matches events that happened within the time range
+func During(tr TimeRange) Predicate {
+	return func(context *BotContext) bool {
+		return tr.Contains(context.Event.Timestamp)
+	}
+}
+
+// When returns a router whose handlers only see events matching predicate. All On*
+// registrations of the returned router are gated by it
+func (r *Router) When(predicate Predicate) *Router {
+	return r.Scope(predicate)
+}
@@ -0,0 +1,84 @@
+package lbotx
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredicates(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+	bot.MenuStates().Map("checkout", "richmenu-checkout")
+
+	user := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+	group := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C1", UserID: "U2"}
+
+	ctx := func(source *linebot.EventSource, text string) *BotContext {
+		return bot.NewContext(textEvent(source, text))
+	}
+
+	assert.True(t, FromUser("U1", "U3")(ctx(user, "")))
+	assert.False(t, FromUser("U1")(ctx(group, "")))
+	assert.True(t, InAnyGroup()(ctx(group, "")))
+	assert.True(t, InGroup("C1")(ctx(group, "")))
+	assert.False(t, InGroup("C2")(ctx(group, "")))
+	assert.False(t, InGroup()(ctx(group, "")))
+	assert.False(t, InAnyGroup()(ctx(user, "")))
+	assert.True(t, InUserChat()(ctx(user, "")))
+
+	order := TextMatches(regexp.MustCompile("^order #\\d+$"))
+	assert.True(t, order(ctx(user, "order #12")))
+	assert.False(t, order(ctx(user, "order something")))
+
+	assert.True(t, And(InAnyGroup(), Not(FromUser("U1")), order)(ctx(group, "order #1")))
+	assert.False(t, And(InAnyGroup(), order)(ctx(group, "hello")))
+	assert.True(t, Or(InUserChat(), order)(ctx(user, "hello")))
+	assert.False(t, Or()(ctx(user, "hello")))
+
+	c := ctx(user, "")
+	assert.False(t, HasSessionState("checkout")(c))
+	bot.menuStates.Store.Set("U1", "checkout")
+	assert.True(t, HasSessionState("checkout")(c))
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	night, e := NewTimeRange("22:00", "06:00", tokyo)
+	assert.Nil(t, e)
+	assert.True(t, night.Contains(time.Date(2017, 5, 1, 23, 30, 0, 0, tokyo)))
+	assert.True(t, night.Contains(time.Date(2017, 5, 1, 5, 59, 0, 0, tokyo)))
+	assert.False(t, night.Contains(time.Date(2017, 5, 1, 6, 0, 0, 0, tokyo)))
+	assert.True(t, night.Contains(time.Date(2017, 5, 1, 14, 0, 0, 0, time.UTC)))
+
+	_, e = NewTimeRange("9am", "17:00", tokyo)
+	assert.Equal(t, e, ErrorInvalidTimeRange)
+
+	c.Event.Timestamp = time.Date(2017, 5, 1, 23, 0, 0, 0, tokyo)
+	assert.True(t, During(night)(c))
+
+	//Without MenuStates nobody has a state, not even the default one
+	bot, _ = NewBot("test", "test")
+	assert.False(t, HasSessionState("")(bot.NewContext(textEvent(user, ""))))
+}
+
+func TestWhen(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	handled := []string{}
+	bot.When(And(InAnyGroup(), TextMatches(regexp.MustCompile("^/")))).OnText(func(context *BotContext, text string) (bool, error) {
+		handled = append(handled, "command:"+text)
+		return false, nil
+	})
+	bot.When(Not(InAnyGroup())).OnText(func(context *BotContext, text string) (bool, error) {
+		handled = append(handled, "chat:"+text)
+		return false, nil
+	})
+
+	group := &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C1", UserID: "U2"}
+	dispatch(bot, textEvent(group, "/help"))
+	dispatch(bot, textEvent(group, "hello"))
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "hello"))
+
+	assert.Equal(t, handled, []string{"command:/help", "chat:hello"})
+}
@@ -0,0 +1,282 @@
+package lbotx
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorQuotaExceeded = errors.New("Push would exceed the monthly message budget")
+)
+
+// LINE counts messages per calendar month in Japan time
+var quotaZone = time.FixedZone("JST", 9*60*60)
+
+// QuotaBudget limits pushed messages per month. Messages count once per recipient
+type QuotaBudget struct {
+	// Limit caps pushes below the LINE quota. 0 only keeps to the LINE quota
+	Limit int64
+	// WarnAt is the fraction of the limit from which warning hooks are called, e.g. 0.8
+	WarnAt float64
+	// HardStop fails pushes over the limit with ErrorQuotaExceeded. Otherwise they are
+	// sent and warning hooks are called
+	HardStop bool
+}
+
+// QuotaUsage is the usage of the month. Used is the consumption LINE reported plus Sent,
+// the pushes counted since. Limit is -1 when there is none
+type QuotaUsage struct {
+	Limit     int64
+	Used      int64
+	Sent      int64
+	FetchedAt time.Time
+}
+
+func (u QuotaUsage) Remaining() int64 {
+	if u.Limit < 0 {
+		return -1
+	}
+	if u.Used > u.Limit {
+		return 0
+	}
+	return u.Limit - u.Used
+}
+
+// QuotaTracker checks pushes of PostMan against the budget before they are sent. Quota and
+// consumption are fetched from LINE every CacheTTL and at the start of a month, pushes in
+// between are counted locally. Replies are free and never checked
+type QuotaTracker struct {
+	Budget   QuotaBudget
+	CacheTTL time.Duration
+	// RetryAfter is how long a failed refresh is not tried again. The last known usage is
+	// used meanwhile
+	RetryAfter time.Duration
+	Clock      Clock
+
+	bot        *linebot.Client
+	lock       sync.Mutex
+	quota      int64
+	consumed   int64
+	sent       int64
+	fetchedAt  time.Time
+	failedAt   time.Time
+	failure    error
+	refreshing chan bool //Closed when the refresh in progress is done
+	outdated   bool      //A broadcast went out, its recipients only LINE knows
+	warned     bool
+	onWarning  []func(usage QuotaUsage)
+}
+
+// NewQuotaTracker creates a tracker refreshing every 10 minutes, or a minute after a failed
+// refresh. Set it with Bot.SetQuota
+func (b *Bot) NewQuotaTracker(budget QuotaBudget) *QuotaTracker {
+	return &QuotaTracker{
+		Budget:     budget,
+		CacheTTL:   10 * time.Minute,
+		RetryAfter: time.Minute,
+		Clock:      systemClock{},
+		bot:        b.Client,
+	}
+}
+
+// SetQuota checks pushes of every PostMan the bot creates against q from now on
+func (b *Bot) SetQuota(q *QuotaTracker) {
+	b.quota = q
+}
+
+// OnWarning calls handler when usage reaches Budget.WarnAt, and when a push goes over the
+// limit without HardStop. It is called once until the next refresh
+func (q *QuotaTracker) OnWarning(handler func(usage QuotaUsage)) {
+	q.lock.Lock()
+	q.onWarning = append(q.onWarning, handler)
+	q.lock.Unlock()
+}
+
+// Refresh fetches quota and consumption and resets the local counter
+func (q *QuotaTracker) Refresh() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.refresh()
+}
+
+// refresh is called with q.lock held and releases it while calling the API. One refresh
+// runs at a time, pushes counted meanwhile are kept
+func (q *QuotaTracker) refresh() error {
+	for q.refreshing != nil {
+		q.wait()
+	}
+
+	done := make(chan bool)
+	q.refreshing = done
+	sent, outdated := q.sent, q.outdated
+	q.outdated = false
+	q.lock.Unlock()
+
+	quota, consumption, e := q.fetch()
+
+	q.lock.Lock()
+	q.refreshing = nil
+	close(done)
+
+	if e != nil {
+		q.failedAt, q.failure = q.Clock.Now(), e
+		q.outdated = q.outdated || outdated
+		return e
+	}
+
+	q.quota = -1
+	if quota.Type == "limited" {
+		q.quota = quota.Value
+	}
+	q.consumed = consumption.TotalUsage
+	q.sent -= sent
+	q.fetchedAt = q.Clock.Now()
+	q.failedAt, q.failure = time.Time{}, nil
+	q.warned = false
+	return nil
+}
+
+func (q *QuotaTracker) fetch() (*linebot.MessageQuotaResponse, *linebot.MessageConsumptionResponse, error) {
+	quota, e := q.bot.GetMessageQuota().Do()
+	if e != nil {
+		return nil, nil, wrapAPIError(e, nil)
+	}
+	consumption, e := q.bot.GetMessageConsumption().Do()
+	if e != nil {
+		return nil, nil, wrapAPIError(e, nil)
+	}
+	return quota, consumption, nil
+}
+
+// wait releases q.lock until the refresh in progress is done
+func (q *QuotaTracker) wait() {
+	done := q.refreshing
+	q.lock.Unlock()
+	<-done
+	q.lock.Lock()
+}
+
+func (q *QuotaTracker) stale() bool {
+	if q.fetchedAt.IsZero() || q.outdated {
+		return true
+	}
+
+	now := q.Clock.Now()
+	if now.Sub(q.fetchedAt) >= q.CacheTTL {
+		return true
+	}
+
+	fetched := q.fetchedAt.In(quotaZone)
+	now = now.In(quotaZone)
+	return fetched.Year() != now.Year() || fetched.Month() != now.Month()
+}
+
+// ensure refreshes stale data. While a refresh is in progress or backing off after a
+// failure, it goes on with the data it has. Without any it waits, or fails
+func (q *QuotaTracker) ensure() error {
+	for q.stale() {
+		if q.refreshing != nil {
+			if !q.fetchedAt.IsZero() {
+				return nil
+			}
+			q.wait()
+			continue
+		}
+
+		if !q.failedAt.IsZero() && q.Clock.Now().Sub(q.failedAt) < q.RetryAfter {
+			if q.fetchedAt.IsZero() {
+				return q.failure
+			}
+			return nil
+		}
+
+		if e := q.refresh(); e != nil {
+			if q.fetchedAt.IsZero() {
+				return e
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func (q *QuotaTracker) usage() QuotaUsage {
+	limit := q.quota
+	if q.Budget.Limit > 0 && (limit < 0 || q.Budget.Limit < limit) {
+		limit = q.Budget.Limit
+	}
+
+	return QuotaUsage{
+		Limit:     limit,
+		Used:      q.consumed + q.sent,
+		Sent:      q.sent,
+		FetchedAt: q.fetchedAt,
+	}
+}
+
+func (q *QuotaTracker) Usage() (QuotaUsage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if e := q.ensure(); e != nil {
+		return QuotaUsage{}, e
+	}
+	return q.usage(), nil
+}
+
+// reserve counts n messages before they are pushed, or fails with ErrorQuotaExceeded. A
+// broadcast reserves 0 as its recipients are unknown, it only needs room left and makes
+// the tracker refresh afterwards
+func (q *QuotaTracker) reserve(n int64) error {
+	q.lock.Lock()
+
+	if e := q.ensure(); e != nil {
+		q.lock.Unlock()
+		return e
+	}
+
+	usage := q.usage()
+	need := n
+	if need < 1 {
+		need = 1
+	}
+	over := usage.Limit >= 0 && usage.Used+need > usage.Limit
+	if over && q.Budget.HardStop {
+		q.lock.Unlock()
+		return ErrorQuotaExceeded
+	}
+
+	q.sent += n
+	usage.Used += n
+	usage.Sent += n
+
+	warn := over || (usage.Limit >= 0 && q.Budget.WarnAt > 0 && float64(usage.Used) >= q.Budget.WarnAt*float64(usage.Limit))
+	var handlers []func(usage QuotaUsage)
+	if warn && !q.warned {
+		q.warned = true
+		handlers = q.onWarning
+	}
+	q.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(usage)
+	}
+	return nil
+}
+
+// invalidate makes the next check fetch the consumption again, after a broadcast
+func (q *QuotaTracker) invalidate() {
+	q.lock.Lock()
+	q.outdated = true
+	q.lock.Unlock()
+}
+
+// release gives back messages reserved for a push that failed
+func (q *QuotaTracker) release(n int64) {
+	q.lock.Lock()
+	q.sent -= n
+	q.lock.Unlock()
+}
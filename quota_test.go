@@ -0,0 +1,191 @@
+package lbotx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaTracker(t *testing.T) {
+	consumption := "7"
+	requests := []string{}
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+		switch req.URL.Path {
+		case "/v2/bot/message/quota":
+			w.Write([]byte(`{"type":"limited","value":10}`))
+		case "/v2/bot/message/quota/consumption":
+			w.Write([]byte(`{"totalUsage":` + consumption + `}`))
+		default:
+			requests = append(requests, req.URL.Path)
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	clock := &fakeClock{time.Date(2024, 3, 8, 8, 0, 0, 0, time.UTC)}
+	quota := bot.NewQuotaTracker(QuotaBudget{WarnAt: 0.8, HardStop: true})
+	quota.Clock = clock
+	bot.SetQuota(quota)
+
+	warnings := []QuotaUsage{}
+	quota.OnWarning(func(usage QuotaUsage) {
+		warnings = append(warnings, usage)
+	})
+
+	pm := bot.NewPostMan().WithRetryPolicy(NoRetry).WithContinueOnError(true)
+	pm.AddTextMessage("hello")
+	pm.AddTextMessage("world")
+
+	report := pm.Send("U1", "U2")
+	assert.Nil(t, report.Err())
+	assert.Equal(t, len(warnings), 1)
+	assert.Equal(t, warnings[0].Used, int64(8))
+
+	//Over the quota, nothing is sent
+	report = pm.Multicast("U3", "U4")
+	assert.Equal(t, report.Err(), ErrorQuotaExceeded)
+	assert.Equal(t, pm.Send("U3", "U4").Delivered(), []string{"U3"})
+	assert.Equal(t, requests, []string{"/v2/bot/message/push", "/v2/bot/message/push", "/v2/bot/message/push"})
+
+	usage, _ := quota.Usage()
+	assert.Equal(t, usage, QuotaUsage{Limit: 10, Used: 10, Sent: 3, FetchedAt: clock.now})
+	assert.Equal(t, usage.Remaining(), int64(0))
+
+	//Replies are exempt
+	context := bot.NewContext(nil)
+	context.Messages.AddTextMessage("hi")
+	assert.Nil(t, context.Messages.reply("token"))
+
+	//Refreshed after CacheTTL, the local counter starts over
+	consumption = "4"
+	clock.now = clock.now.Add(10 * time.Minute)
+	usage, _ = quota.Usage()
+	assert.Equal(t, usage.Used, int64(4))
+	assert.Equal(t, usage.Sent, int64(0))
+
+	//And at the start of a month in Japan
+	consumption = "0"
+	clock.now = time.Date(2024, 3, 31, 15, 0, 0, 0, time.UTC)
+	assert.Nil(t, bot.NewPostMan().Broadcast().Err())
+	usage, _ = quota.Usage()
+	assert.Equal(t, usage.Used, int64(0))
+
+	//Fetched again after a broadcast, LINE counted its recipients
+	consumption = "3"
+	assert.Nil(t, bot.NewPostMan().Broadcast().Err())
+	usage, _ = quota.Usage()
+	assert.Equal(t, usage.Used, int64(3))
+}
+
+func TestQuotaBudget(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+		switch req.URL.Path {
+		case "/v2/bot/message/quota":
+			w.Write([]byte(`{"type":"none"}`))
+		case "/v2/bot/message/quota/consumption":
+			w.Write([]byte(`{"totalUsage":100}`))
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	//A soft budget warns once and keeps sending
+	quota := bot.NewQuotaTracker(QuotaBudget{Limit: 100})
+	warnings := 0
+	quota.OnWarning(func(usage QuotaUsage) {
+		warnings++
+	})
+
+	pm := bot.NewPostMan().WithQuota(quota)
+	pm.AddTextMessage("hello")
+	assert.Nil(t, pm.Send("U1", "U2").Err())
+	assert.Equal(t, warnings, 1)
+
+	usage, _ := quota.Usage()
+	assert.Equal(t, usage.Limit, int64(100))
+	assert.Equal(t, usage.Used, int64(102))
+
+	//No quota and no budget
+	unlimited := bot.NewQuotaTracker(QuotaBudget{HardStop: true})
+	pm = bot.NewPostMan().WithQuota(unlimited)
+	pm.AddTextMessage("hello")
+	assert.Nil(t, pm.Send("U1").Err())
+
+	usage, _ = unlimited.Usage()
+	assert.Equal(t, usage.Limit, int64(-1))
+	assert.Equal(t, usage.Remaining(), int64(-1))
+}
+
+func TestQuotaTrackerBackoff(t *testing.T) {
+	down := false
+	refreshes := 0
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/bot/message/quota":
+			refreshes++
+			if down {
+				w.WriteHeader(500)
+				w.Write([]byte("{}"))
+				return
+			}
+			w.WriteHeader(200)
+			w.Write([]byte(`{"type":"limited","value":10}`))
+		case "/v2/bot/message/quota/consumption":
+			w.WriteHeader(200)
+			w.Write([]byte(`{"totalUsage":2}`))
+		default:
+			w.WriteHeader(200)
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	clock := &fakeClock{time.Date(2024, 3, 8, 8, 0, 0, 0, time.UTC)}
+	quota := bot.NewQuotaTracker(QuotaBudget{HardStop: true})
+	quota.Clock = clock
+
+	//Nothing known yet, pushes fail without calling the API again
+	down = true
+	pm := bot.NewPostMan().WithQuota(quota).WithRetryPolicy(NoRetry)
+	pm.AddTextMessage("hello")
+	for i := 0; i < 5; i++ {
+		assert.NotNil(t, pm.Send("U1").Err())
+	}
+	assert.Equal(t, refreshes, 1)
+
+	down = false
+	clock.now = clock.now.Add(time.Minute)
+	assert.Nil(t, pm.Send("U1").Err())
+	assert.Equal(t, refreshes, 2)
+
+	//The API is down again, the last usage is used until RetryAfter
+	down = true
+	clock.now = clock.now.Add(10 * time.Minute)
+	for i := 0; i < 5; i++ {
+		pm.AddTextMessage("hello")
+		assert.Nil(t, pm.Send("U1").Err())
+	}
+	assert.Equal(t, refreshes, 3)
+
+	usage, _ := quota.Usage()
+	assert.Equal(t, usage.Used, int64(8))
+
+	clock.now = clock.now.Add(time.Minute)
+	quota.Usage()
+	assert.Equal(t, refreshes, 4)
+}
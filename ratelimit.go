@@ -0,0 +1,199 @@
+package lbotx
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorRateLimitWait = errors.New("Waiting for the rate limit would take longer than allowed")
+)
+
+// EndpointCategory groups LINE API endpoints sharing a rate limit
+type EndpointCategory string
+
+const (
+	EndpointReply     EndpointCategory = "reply"
+	EndpointPush      EndpointCategory = "push"
+	EndpointMulticast EndpointCategory = "multicast"
+	EndpointBroadcast EndpointCategory = "broadcast"
+	EndpointProfile   EndpointCategory = "profile"
+	EndpointContent   EndpointCategory = "content"
+	EndpointOther     EndpointCategory = "other"
+)
+
+func endpointCategory(path string) EndpointCategory {
+	switch {
+	case strings.HasPrefix(path, "/v2/bot/message/reply"):
+		return EndpointReply
+	case strings.HasPrefix(path, "/v2/bot/message/push"):
+		return EndpointPush
+	case strings.HasPrefix(path, "/v2/bot/message/multicast"):
+		return EndpointMulticast
+	case strings.HasPrefix(path, "/v2/bot/message/broadcast"):
+		return EndpointBroadcast
+	case strings.HasPrefix(path, "/v2/bot/message/") && strings.HasSuffix(path, "/content"):
+		return EndpointContent
+	case strings.HasPrefix(path, "/v2/bot/profile/") || strings.Contains(path, "/member/"):
+		return EndpointProfile
+	}
+	return EndpointOther
+}
+
+// RateLimit allows Rate requests per second with bursts of Burst. Requests over the limit
+// wait for their turn, for at most MaxWait when it's not 0. A Rate of 0 or less is no limit
+type RateLimit struct {
+	Rate    float64
+	Burst   int
+	MaxWait time.Duration
+}
+
+// DefaultRateLimits follow the limits LINE documents for each kind of endpoint
+var DefaultRateLimits = map[EndpointCategory]RateLimit{
+	EndpointReply:     {Rate: 2000, Burst: 2000},
+	EndpointPush:      {Rate: 2000, Burst: 2000},
+	EndpointMulticast: {Rate: 200, Burst: 200},
+	EndpointBroadcast: {Rate: 60.0 / 3600, Burst: 60},
+	EndpointProfile:   {Rate: 2000, Burst: 2000},
+	EndpointContent:   {Rate: 2000, Burst: 2000},
+	EndpointOther:     {Rate: 2000, Burst: 2000},
+}
+
+// RateLimitStats counts requests of a category and how long they waited
+type RateLimitStats struct {
+	Requests  int
+	Waited    int
+	Rejected  int
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	stats  RateLimitStats
+}
+
+// reserve takes a token, borrowing from the future when there is none left, and returns
+// how long to wait before using it
+func (b *tokenBucket) reserve(now time.Time) (time.Duration, bool) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+	b.last = now
+
+	wait := time.Duration(0)
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	}
+
+	if b.limit.MaxWait > 0 && wait > b.limit.MaxWait {
+		return wait, false
+	}
+
+	b.tokens--
+	return wait, true
+}
+
+// RateLimiter keeps LINE API calls of the bot within rate limits, one token bucket per
+// endpoint category. Set it with Bot.SetRateLimiter
+type RateLimiter struct {
+	lock    sync.Mutex
+	buckets map[EndpointCategory]*tokenBucket
+}
+
+// NewRateLimiter creates a limiter for limits. Categories without a limit, or with a Rate of
+// 0 or less, are not limited
+func NewRateLimiter(limits map[EndpointCategory]RateLimit) *RateLimiter {
+	l := &RateLimiter{buckets: make(map[EndpointCategory]*tokenBucket)}
+
+	now := time.Now()
+	for category, limit := range limits {
+		if limit.Rate <= 0 {
+			continue
+		}
+		l.buckets[category] = &tokenBucket{
+			limit:  limit,
+			tokens: float64(limit.Burst),
+			last:   now,
+		}
+	}
+	return l
+}
+
+// Wait blocks until a request of category can go, or fails with ErrorRateLimitWait when it
+// would wait longer than MaxWait, or with the error of ctx when it's done first
+func (l *RateLimiter) Wait(ctx context.Context, category EndpointCategory) error {
+	l.lock.Lock()
+	bucket, ok := l.buckets[category]
+	if !ok {
+		l.lock.Unlock()
+		return nil
+	}
+
+	wait, ok := bucket.reserve(time.Now())
+	bucket.stats.Requests++
+	if !ok {
+		bucket.stats.Rejected++
+		l.lock.Unlock()
+		return ErrorRateLimitWait
+	}
+
+	if wait > 0 {
+		bucket.stats.Waited++
+		bucket.stats.TotalWait += wait
+		if wait > bucket.stats.MaxWait {
+			bucket.stats.MaxWait = wait
+		}
+	}
+	l.lock.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.lock.Lock()
+		bucket.tokens++ //Give the token back
+		l.lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *RateLimiter) Stats() map[EndpointCategory]RateLimitStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	stats := make(map[EndpointCategory]RateLimitStats)
+	for category, bucket := range l.buckets {
+		stats[category] = bucket.stats
+	}
+	return stats
+}
+
+// Transport wraps base like lbotx.Transport and limits requests going through it, for
+// linebot clients created without NewBot
+func (l *RateLimiter) Transport(base http.RoundTripper) http.RoundTripper {
+	t := Transport(base).(*apiTransport)
+	t.setLimiter(l)
+	return t
+}
+
+// SetRateLimiter limits every LINE API call of the bot, replies of handlers and pushes of
+// PostMan included
+func (b *Bot) SetRateLimiter(l *RateLimiter) {
+	if b.transport != nil {
+		b.transport.setLimiter(l)
+	}
+}
@@ -0,0 +1,105 @@
+package lbotx
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointCategory(t *testing.T) {
+	assert.Equal(t, endpointCategory("/v2/bot/message/reply"), EndpointReply)
+	assert.Equal(t, endpointCategory("/v2/bot/message/push"), EndpointPush)
+	assert.Equal(t, endpointCategory("/v2/bot/message/multicast"), EndpointMulticast)
+	assert.Equal(t, endpointCategory("/v2/bot/message/broadcast"), EndpointBroadcast)
+	assert.Equal(t, endpointCategory("/v2/bot/message/1234/content"), EndpointContent)
+	assert.Equal(t, endpointCategory("/v2/bot/profile/U1"), EndpointProfile)
+	assert.Equal(t, endpointCategory("/v2/bot/group/G1/member/U1"), EndpointProfile)
+	assert.Equal(t, endpointCategory("/v2/bot/richmenu/list"), EndpointOther)
+}
+
+func TestRateLimiter(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	limiter := NewRateLimiter(map[EndpointCategory]RateLimit{
+		EndpointPush:  {Rate: 20, Burst: 1},
+		EndpointReply: {Rate: 1, Burst: 1, MaxWait: 10 * time.Millisecond},
+	})
+
+	client, _ := linebot.New("test", "test",
+		linebot.WithHTTPClient(&http.Client{
+			Transport: limiter.Transport(&http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}),
+		}),
+		linebot.WithEndpointBase(mockServer.URL),
+	)
+
+	//Pushes queue instead of failing
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, e := client.PushMessage("U1", linebot.NewTextMessage("hi")).Do()
+		assert.Nil(t, e)
+	}
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	//Replies would wait too long
+	_, e := client.ReplyMessage("token", linebot.NewTextMessage("hi")).Do()
+	assert.Nil(t, e)
+	_, e = client.ReplyMessage("token", linebot.NewTextMessage("hi")).Do()
+	assert.NotNil(t, e)
+
+	//Profiles are not limited
+	_, e = client.GetProfile("U1").Do()
+	assert.Nil(t, e)
+
+	stats := limiter.Stats()
+	assert.Equal(t, stats[EndpointPush].Requests, 3)
+	assert.Equal(t, stats[EndpointPush].Waited, 2)
+	assert.True(t, stats[EndpointPush].MaxWait > 40*time.Millisecond)
+	assert.True(t, stats[EndpointPush].TotalWait >= stats[EndpointPush].MaxWait)
+	assert.Equal(t, stats[EndpointReply].Requests, 2)
+	assert.Equal(t, stats[EndpointReply].Rejected, 1)
+	_, ok := stats[EndpointProfile]
+	assert.False(t, ok)
+}
+
+func TestRateLimiterContext(t *testing.T) {
+	limiter := NewRateLimiter(map[EndpointCategory]RateLimit{
+		EndpointPush: {Rate: 1, Burst: 1},
+	})
+	assert.Nil(t, limiter.Wait(context.Background(), EndpointPush))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, limiter.Wait(ctx, EndpointPush), context.DeadlineExceeded)
+}
+
+func TestRateLimiterNoRate(t *testing.T) {
+	limiter := NewRateLimiter(map[EndpointCategory]RateLimit{
+		EndpointPush:  {Rate: 0, Burst: 1},
+		EndpointReply: {Rate: -1, MaxWait: time.Millisecond},
+	})
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, limiter.Wait(context.Background(), EndpointPush))
+		assert.Nil(t, limiter.Wait(context.Background(), EndpointReply))
+	}
+	assert.Equal(t, len(limiter.Stats()), 0)
+}
+
+func TestSetRateLimiter(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+	limiter := NewRateLimiter(DefaultRateLimits)
+	bot.SetRateLimiter(limiter)
+	assert.Equal(t, bot.transport.limiter.Load(), limiter)
+}
@@ -0,0 +1,143 @@
+package lbotx
+
+import (
+	"crypto/rand"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// RetryPolicy retries retryable errors (see IsRetryable) with exponential backoff. Jitter
+// is the fraction of each backoff that is randomized, from 0 to 1
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+}
+
+var (
+	DefaultRetryPolicy = RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+	NoRetry = RetryPolicy{MaxAttempts: 1}
+)
+
+// Backoff returns how long to wait after the attempt-th failed attempt, counting from 1
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+			backoff = float64(p.MaxBackoff)
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		backoff -= backoff * p.Jitter * mrand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+// PushOutcome is the final result of pushing to a recipient
+type PushOutcome struct {
+	To       string
+	RetryKey string
+	Attempts int
+	Err      error
+}
+
+// newRetryKey generates a uuid v4, the format X-Line-Retry-Key requires
+func newRetryKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (pm *PostMan) wait(d time.Duration) {
+	if pm.sleep != nil {
+		pm.sleep(d)
+	} else {
+		time.Sleep(d)
+	}
+}
+
+// withRetry calls send with the same retry key for every attempt, so LINE delivers once
+// even if a timed out attempt went through
+func (pm *PostMan) withRetry(to, retryKey string, send func(retryKey string) error) PushOutcome {
+	outcome := PushOutcome{To: to, RetryKey: retryKey}
+
+	for {
+		outcome.Attempts++
+		outcome.Err = send(outcome.RetryKey)
+
+		if apiError, ok := AsAPIError(outcome.Err); ok && apiError.StatusCode == http.StatusConflict {
+			outcome.Err = nil //Accepted by an earlier request with this key
+		}
+
+		if outcome.Err == nil || !IsRetryable(outcome.Err) || outcome.Attempts >= pm.Retry.MaxAttempts {
+			break
+		}
+		pm.wait(pm.Retry.Backoff(outcome.Attempts))
+	}
+
+	return outcome
+}
+
+// pushWithRetry pushes to to with retryKey, or a new key if empty
+func (pm *PostMan) pushWithRetry(to, retryKey string) PushOutcome {
+	if retryKey == "" {
+		retryKey = newRetryKey()
+	}
+
+	//Rendered once, fetching the profile is retried like the push
+	var messages []linebot.Message
+	personalized := false
+	outcome := pm.withRetry(to, retryKey, func(retryKey string) error {
+		if !personalized {
+			m, e := pm.personalize(to)
+			if e != nil {
+				return e
+			}
+			messages, personalized = m, true
+		}
+		return pm.pushMessages(to, retryKey, messages)
+	})
+
+	pm.record(outcome)
+	return outcome
+}
+
+func (pm *PostMan) record(outcome PushOutcome) {
+	pm.outcomesLock.Lock()
+	if pm.outcomes == nil {
+		pm.outcomes = make(map[string]PushOutcome)
+	}
+	pm.outcomes[outcome.To] = outcome
+	pm.outcomesLock.Unlock()
+}
+
+// Outcome returns the result of the last push or multicast to a recipient
+func (pm *PostMan) Outcome(to string) (PushOutcome, bool) {
+	pm.outcomesLock.Lock()
+	defer pm.outcomesLock.Unlock()
+
+	outcome, ok := pm.outcomes[to]
+	return outcome, ok
+}
@@ -0,0 +1,100 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	assert.Equal(t, policy.Backoff(1), time.Second)
+	assert.Equal(t, policy.Backoff(2), 2*time.Second)
+	assert.Equal(t, policy.Backoff(3), 4*time.Second)
+	assert.Equal(t, policy.Backoff(4), 5*time.Second)
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := policy.Backoff(2)
+		assert.True(t, backoff > time.Second && backoff <= 2*time.Second)
+	}
+
+	assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"), newRetryKey())
+}
+
+func TestPushWithRetry(t *testing.T) {
+	responses := map[string][]int{
+		"U1": {500, 429, 200},
+		"U2": {400},
+		"U3": {503, 409},
+		"U4": {500, 500, 500, 500, 500},
+	}
+	retryKeys := map[string][]string{}
+
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body := struct {
+			To string `json:"to"`
+		}{}
+		json.Unmarshal(data, &body)
+
+		retryKeys[body.To] = append(retryKeys[body.To], req.Header.Get("X-Line-Retry-Key"))
+		status := responses[body.To][0]
+		responses[body.To] = responses[body.To][1:]
+
+		w.WriteHeader(status)
+		w.Write([]byte(`{"message":"failed"}`))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	sleeps := []time.Duration{}
+	pm := bot.NewPostMan().WithRetryPolicy(RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, Multiplier: 2})
+	pm.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+	pm.AddTextMessage("hello")
+
+	success, e := pm.SendImmediately("U1", "U3")
+	assert.Nil(t, e)
+	assert.Equal(t, success, []string{"U1", "U3"})
+	assert.Equal(t, sleeps, []time.Duration{time.Second, 2 * time.Second, time.Second})
+
+	outcome, ok := pm.Outcome("U1")
+	assert.True(t, ok)
+	assert.Equal(t, outcome.Attempts, 3)
+	assert.Equal(t, retryKeys["U1"], []string{outcome.RetryKey, outcome.RetryKey, outcome.RetryKey})
+
+	outcome, _ = pm.Outcome("U3")
+	assert.Equal(t, outcome.Attempts, 2)
+	assert.Nil(t, outcome.Err)
+	assert.NotEqual(t, retryKeys["U3"][0], retryKeys["U1"][0])
+
+	pm.AddTextMessage("hello")
+	sleeps = []time.Duration{}
+	success, e = pm.SendImmediately("U2", "U4")
+	assert.NotNil(t, e)
+	assert.Equal(t, success, []string{})
+	assert.Equal(t, len(sleeps), 0)
+
+	outcome, _ = pm.Outcome("U2")
+	assert.Equal(t, outcome.Attempts, 1)
+	assert.Equal(t, outcome.Err, e)
+
+	_, ok = pm.Outcome("U4")
+	assert.False(t, ok)
+
+	pm.WithRetryPolicy(RetryPolicy{MaxAttempts: 4})
+	_, e = pm.SendImmediately("U4")
+	assert.True(t, IsRetryable(e))
+	outcome, _ = pm.Outcome("U4")
+	assert.Equal(t, outcome.Attempts, 4)
+}
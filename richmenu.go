@@ -0,0 +1,579 @@
+package lbotx
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorInvalidRichMenuSize  = errors.New("Rich menu width should be 800~2500, height at least 250 and width/height at least 1.45")
+	ErrorTooManyAreas         = errors.New("Rich menu can have at most 20 areas")
+	ErrorInvalidRichMenuImage = errors.New("Rich menu image should be a JPEG or PNG up to 1MB with the same size as the menu")
+	ErrorMissingRichMenuName  = errors.New("Rich menu definition without name")
+)
+
+const (
+	richMenuMaxAreas      = 20
+	richMenuMaxImageSize  = 1024 * 1024
+	richMenuMaxNameLength = 300
+)
+
+// RichMenuBuilder builds a rich menu. Areas are given in pixels or in a grid like ImageMapBuilder
+type RichMenuBuilder struct {
+	Name        string
+	ChatBarText string
+	Width       int
+	Height      int
+	Selected    bool
+
+	// Image is the path of the menu image uploaded by DeployRichMenu
+	Image string
+	// Alias is created or switched to the menu by DeployRichMenu
+	Alias string
+
+	areas   []linebot.AreaDetail
+	layouts []*richMenuLayoutArea
+}
+
+type richMenuLayoutArea struct {
+	action linebot.RichMenuAction
+	rect   relativeRect
+}
+
+func NewRichMenuBuilder(name, chatBarText string, width, height int) *RichMenuBuilder {
+	return &RichMenuBuilder{
+		Name:        name,
+		ChatBarText: chatBarText,
+		Width:       width,
+		Height:      height,
+	}
+}
+
+func (rb *RichMenuBuilder) WithImage(path string) *RichMenuBuilder {
+	rb.Image = path
+	return rb
+}
+
+func (rb *RichMenuBuilder) WithAlias(alias string) *RichMenuBuilder {
+	rb.Alias = alias
+	return rb
+}
+
+func (rb *RichMenuBuilder) WithAction(action linebot.RichMenuAction, x, y, width, height int) *RichMenuBuilder {
+	rb.areas = append(rb.areas, linebot.AreaDetail{
+		Bounds: linebot.RichMenuBounds{x, y, width, height},
+		Action: action,
+	})
+	return rb
+}
+
+func (rb *RichMenuBuilder) WithMessageAction(text string, x, y, width, height int) *RichMenuBuilder {
+	return rb.WithAction(richMenuMessageAction(text), x, y, width, height)
+}
+
+func (rb *RichMenuBuilder) WithURIAction(uri string, x, y, width, height int) *RichMenuBuilder {
+	return rb.WithAction(richMenuURIAction(uri), x, y, width, height)
+}
+
+func (rb *RichMenuBuilder) WithPostbackAction(data, displayText string, x, y, width, height int) *RichMenuBuilder {
+	return rb.WithAction(richMenuPostbackAction(data, displayText), x, y, width, height)
+}
+
+// WithSwitchAction switches the user to the rich menu with the given alias
+func (rb *RichMenuBuilder) WithSwitchAction(alias, data string, x, y, width, height int) *RichMenuBuilder {
+	return rb.WithAction(richMenuSwitchAction(alias, data), x, y, width, height)
+}
+
+func richMenuMessageAction(text string) linebot.RichMenuAction {
+	return linebot.RichMenuAction{Type: linebot.RichMenuActionTypeMessage, Text: text}
+}
+
+func richMenuURIAction(uri string) linebot.RichMenuAction {
+	return linebot.RichMenuAction{Type: linebot.RichMenuActionTypeURI, URI: uri}
+}
+
+func richMenuPostbackAction(data, displayText string) linebot.RichMenuAction {
+	return linebot.RichMenuAction{Type: linebot.RichMenuActionTypePostback, Data: data, DisplayText: displayText}
+}
+
+func richMenuSwitchAction(alias, data string) linebot.RichMenuAction {
+	return linebot.RichMenuAction{Type: linebot.RichMenuActionTypeRichMenuSwitch, RichMenuAliasID: alias, Data: data}
+}
+
+// RichMenuGrid divides the rich menu into rows x cols cells
+type RichMenuGrid struct {
+	builder *RichMenuBuilder
+	rows    int
+	cols    int
+}
+
+func (rb *RichMenuBuilder) Grid(rows, cols int) *RichMenuGrid {
+	return &RichMenuGrid{
+		builder: rb,
+		rows:    rows,
+		cols:    cols,
+	}
+}
+
+func (g *RichMenuGrid) WithActionSpan(action linebot.RichMenuAction, row, col, rowSpan, colSpan int) *RichMenuGrid {
+	g.builder.layouts = append(g.builder.layouts, &richMenuLayoutArea{
+		action: action,
+		rect:   gridRect(g.rows, g.cols, row, col, rowSpan, colSpan),
+	})
+	return g
+}
+
+func (g *RichMenuGrid) WithAction(action linebot.RichMenuAction, row, col int) *RichMenuGrid {
+	return g.WithActionSpan(action, row, col, 1, 1)
+}
+
+func (g *RichMenuGrid) WithMessageAction(text string, row, col int) *RichMenuGrid {
+	return g.WithAction(richMenuMessageAction(text), row, col)
+}
+
+func (g *RichMenuGrid) WithURIAction(uri string, row, col int) *RichMenuGrid {
+	return g.WithAction(richMenuURIAction(uri), row, col)
+}
+
+func (g *RichMenuGrid) WithPostbackAction(data, displayText string, row, col int) *RichMenuGrid {
+	return g.WithAction(richMenuPostbackAction(data, displayText), row, col)
+}
+
+func (g *RichMenuGrid) WithSwitchAction(alias, data string, row, col int) *RichMenuGrid {
+	return g.WithAction(richMenuSwitchAction(alias, data), row, col)
+}
+
+func validateRichMenuAction(action linebot.RichMenuAction) error {
+	if len([]rune(action.Label)) > 20 || len([]rune(action.DisplayText)) > 300 {
+		return ErrorTextExceedLimit
+	}
+
+	switch action.Type {
+	case linebot.RichMenuActionTypeMessage:
+		if action.Text == "" {
+			return ErrorMissingParam
+		}
+		if len([]rune(action.Text)) > 300 {
+			return ErrorTextExceedLimit
+		}
+	case linebot.RichMenuActionTypeURI:
+		if action.URI == "" {
+			return ErrorMissingParam
+		}
+		if len([]rune(action.URI)) > 1000 {
+			return ErrorTextExceedLimit
+		}
+	case linebot.RichMenuActionTypePostback, linebot.RichMenuActionTypeDatetimePicker:
+		if len([]rune(action.Data)) > 300 {
+			return ErrorTextExceedLimit
+		}
+	case linebot.RichMenuActionTypeRichMenuSwitch:
+		if action.RichMenuAliasID == "" {
+			return ErrorMissingParam
+		}
+		if len([]rune(action.RichMenuAliasID)) > 32 || len([]rune(action.Data)) > 300 {
+			return ErrorTextExceedLimit
+		}
+	}
+
+	return nil
+}
+
+func (rb *RichMenuBuilder) Build() (linebot.RichMenu, error) {
+	menu := linebot.RichMenu{
+		Size:        linebot.RichMenuSize{rb.Width, rb.Height},
+		Selected:    rb.Selected,
+		Name:        rb.Name,
+		ChatBarText: rb.ChatBarText,
+	}
+
+	if rb.Width < 800 || rb.Width > 2500 || rb.Height < 250 || float64(rb.Width)/float64(rb.Height) < 1.45 {
+		return menu, ErrorInvalidRichMenuSize
+	}
+
+	if rb.Name == "" || rb.ChatBarText == "" {
+		return menu, ErrorMissingParam
+	}
+
+	if len([]rune(rb.Name)) > richMenuMaxNameLength || len([]rune(rb.ChatBarText)) > 14 {
+		return menu, ErrorTextExceedLimit
+	}
+
+	areas := make([]linebot.AreaDetail, 0, len(rb.areas)+len(rb.layouts))
+	areas = append(areas, rb.areas...)
+	for _, layout := range rb.layouts {
+		x, y, w, h := layout.rect.pixels(rb.Width, rb.Height)
+		areas = append(areas, linebot.AreaDetail{
+			Bounds: linebot.RichMenuBounds{x, y, w, h},
+			Action: layout.action,
+		})
+	}
+
+	if len(areas) == 0 {
+		return menu, ErrorNoAction
+	}
+
+	if len(areas) > richMenuMaxAreas {
+		return menu, ErrorTooManyAreas
+	}
+
+	for i, area := range areas {
+		b := area.Bounds
+		if b.Width == 0 || b.Height == 0 {
+			return menu, ErrorInvalidMapSize
+		}
+
+		if b.X < 0 || b.Y < 0 || b.X+b.Width > rb.Width || b.Y+b.Height > rb.Height {
+			return menu, ErrorAreaOutOfBounds
+		}
+
+		for _, other := range areas[:i] {
+			o := other.Bounds
+			if rectOverlaps(b.X, b.Y, b.Width, b.Height, o.X, o.Y, o.Width, o.Height) {
+				return menu, ErrorAreaOverlap
+			}
+		}
+
+		if e := validateRichMenuAction(area.Action); e != nil {
+			return menu, e
+		}
+	}
+
+	menu.Areas = areas
+	return menu, nil
+}
+
+func (rb *RichMenuBuilder) validateImage() ([]byte, error) {
+	data, e := ioutil.ReadFile(rb.Image)
+	if e != nil {
+		return nil, e
+	}
+
+	if len(data) > richMenuMaxImageSize {
+		return nil, ErrorInvalidRichMenuImage
+	}
+
+	config, format, e := image.DecodeConfig(bytes.NewReader(data))
+	if e != nil || (format != "jpeg" && format != "png") {
+		return nil, ErrorInvalidRichMenuImage
+	}
+
+	if config.Width != rb.Width || config.Height != rb.Height {
+		return nil, ErrorInvalidRichMenuImage
+	}
+
+	return data, nil
+}
+
+// DeployRichMenu creates the rich menu, uploads its image and points its alias to it
+func (b *Bot) DeployRichMenu(rb *RichMenuBuilder) (string, error) {
+	menu, e := rb.Build()
+	if e != nil {
+		return "", e
+	}
+
+	if rb.Image != "" {
+		if _, e := rb.validateImage(); e != nil {
+			return "", e
+		}
+	}
+
+	return b.deployRichMenu(menu, rb.Image, rb.Alias)
+}
+
+func (b *Bot) deployRichMenu(menu linebot.RichMenu, imagePath, alias string) (string, error) {
+	resp, e := b.CreateRichMenu(menu).Do()
+	if e != nil {
+		return "", e
+	}
+	richMenuId := resp.RichMenuID
+
+	if imagePath != "" {
+		if _, e := b.UploadRichMenuImage(richMenuId, imagePath).Do(); e != nil {
+			b.DeleteRichMenu(richMenuId).Do()
+			return "", e
+		}
+	}
+
+	if alias != "" {
+		if e := b.SetRichMenuAlias(alias, richMenuId); e != nil {
+			return richMenuId, e
+		}
+	}
+
+	return richMenuId, nil
+}
+
+// SetRichMenuAlias points alias to the rich menu, creating the alias when needed
+func (b *Bot) SetRichMenuAlias(alias, richMenuId string) error {
+	current, e := b.GetRichMenuAlias(alias).Do()
+	if e == nil {
+		if current.RichMenuID == richMenuId {
+			return nil
+		}
+
+		_, e = b.UpdateRichMenuAlias(alias, richMenuId).Do()
+		return e
+	}
+
+	if apiError, ok := AsAPIError(wrapAPIError(e, nil)); !ok || apiError.StatusCode != http.StatusNotFound {
+		return e
+	}
+
+	_, e = b.CreateRichMenuAlias(alias, richMenuId).Do()
+	return e
+}
+
+func (c *BotContext) LinkRichMenu(richMenuId string) error {
+	userId := c.GetUserId()
+	if userId == "" {
+		return ErrorInvalidUserId
+	}
+
+	_, e := c.bot.LinkUserRichMenu(userId, richMenuId).Do()
+	return e
+}
+
+// LinkRichMenuAlias links the rich menu the alias points to with the user
+func (c *BotContext) LinkRichMenuAlias(alias string) error {
+	resp, e := c.bot.GetRichMenuAlias(alias).Do()
+	if e != nil {
+		return e
+	}
+
+	return c.LinkRichMenu(resp.RichMenuID)
+}
+
+func (c *BotContext) UnlinkRichMenu() error {
+	userId := c.GetUserId()
+	if userId == "" {
+		return ErrorInvalidUserId
+	}
+
+	_, e := c.bot.UnlinkUserRichMenu(userId).Do()
+	return e
+}
+
+// RichMenuDefinition describes a rich menu in a definition file. Areas are placed in a
+// Rows x Cols grid when both are set, otherwise by their pixel bounds
+type RichMenuDefinition struct {
+	Name        string                   `json:"name"`
+	ChatBarText string                   `json:"chatBarText"`
+	Width       int                      `json:"width"`
+	Height      int                      `json:"height"`
+	Selected    bool                     `json:"selected"`
+	Image       string                   `json:"image"`
+	Alias       string                   `json:"alias"`
+	Default     bool                     `json:"default"`
+	Rows        int                      `json:"rows"`
+	Cols        int                      `json:"cols"`
+	Areas       []RichMenuAreaDefinition `json:"areas"`
+}
+
+type RichMenuAreaDefinition struct {
+	Row     int `json:"row"`
+	Col     int `json:"col"`
+	RowSpan int `json:"rowSpan"`
+	ColSpan int `json:"colSpan"`
+
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	Action linebot.RichMenuAction `json:"action"`
+}
+
+func (d *RichMenuDefinition) Builder() *RichMenuBuilder {
+	rb := NewRichMenuBuilder(d.Name, d.ChatBarText, d.Width, d.Height)
+	rb.Selected = d.Selected
+	rb.Image = d.Image
+	rb.Alias = d.Alias
+
+	grid := rb.Grid(d.Rows, d.Cols)
+	for _, area := range d.Areas {
+		if d.Rows > 0 && d.Cols > 0 {
+			rowSpan, colSpan := area.RowSpan, area.ColSpan
+			if rowSpan == 0 {
+				rowSpan = 1
+			}
+			if colSpan == 0 {
+				colSpan = 1
+			}
+			grid.WithActionSpan(area.Action, area.Row, area.Col, rowSpan, colSpan)
+		} else {
+			rb.WithAction(area.Action, area.X, area.Y, area.Width, area.Height)
+		}
+	}
+
+	return rb
+}
+
+// LoadRichMenuDefinitions reads a JSON array of RichMenuDefinition. Image paths are
+// relative to the definition file
+func LoadRichMenuDefinitions(path string) ([]*RichMenuDefinition, error) {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+
+	defs := []*RichMenuDefinition{}
+	if e := json.Unmarshal(data, &defs); e != nil {
+		return nil, e
+	}
+
+	dir := filepath.Dir(path)
+	for _, d := range defs {
+		if d.Image != "" && !filepath.IsAbs(d.Image) {
+			d.Image = filepath.Join(dir, d.Image)
+		}
+	}
+
+	return defs, nil
+}
+
+// RichMenuSyncResult lists definition names. Deleted has the names of replaced menus and
+// of menus no longer defined
+type RichMenuSyncResult struct {
+	// RichMenuIds maps definition names to their rich menu ids
+	RichMenuIds map[string]string
+	Created     []string
+	Deleted     []string
+	Unchanged   []string
+}
+
+// richMenuSyncName tags the menu name with a hash of its content and image so unchanged
+// definitions are found again on the next sync. Long names are cut to fit the tag
+func richMenuSyncName(menu linebot.RichMenu, image []byte) string {
+	h := sha1.New()
+	json.NewEncoder(h).Encode(menu)
+	h.Write(image)
+
+	name := []rune(menu.Name)
+	if len(name) > richMenuMaxNameLength-14 {
+		name = name[:richMenuMaxNameLength-14]
+	}
+	return string(name) + " #" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+var richMenuSyncNameReg = regexp.MustCompile("^(.*) #[0-9a-f]{12}$")
+
+// richMenuDefinitionName returns the definition name of a menu created by sync
+func richMenuDefinitionName(name string) (string, bool) {
+	matches := richMenuSyncNameReg.FindStringSubmatch(name)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// SyncRichMenus makes the rich menus on LINE match defs. Menus whose definition did not
+// change are kept, changed ones are recreated and replaced, and menus created by an earlier
+// sync that are no longer defined are deleted. Running it again with the same defs makes
+// no changes. Menus created outside of sync are left untouched
+func (b *Bot) SyncRichMenus(defs []*RichMenuDefinition) (*RichMenuSyncResult, error) {
+	result := &RichMenuSyncResult{
+		RichMenuIds: make(map[string]string),
+		Created:     []string{},
+		Deleted:     []string{},
+		Unchanged:   []string{},
+	}
+
+	existing, e := b.GetRichMenuList().Do()
+	if e != nil {
+		return result, e
+	}
+
+	existingByName := make(map[string]*linebot.RichMenuResponse)
+	for _, menu := range existing {
+		existingByName[menu.Name] = menu
+	}
+
+	isCurrent := make(map[string]bool)
+	for _, d := range defs {
+		if d.Name == "" {
+			return result, ErrorMissingRichMenuName
+		}
+
+		rb := d.Builder()
+		menu, e := rb.Build()
+		if e != nil {
+			return result, e
+		}
+
+		var image []byte
+		if rb.Image != "" {
+			if image, e = rb.validateImage(); e != nil {
+				return result, e
+			}
+		}
+
+		syncName := richMenuSyncName(menu, image)
+		menu.Name = syncName
+
+		richMenuId := ""
+		if current, ok := existingByName[syncName]; ok {
+			richMenuId = current.RichMenuID
+			result.Unchanged = append(result.Unchanged, d.Name)
+			if d.Alias != "" {
+				if e := b.SetRichMenuAlias(d.Alias, richMenuId); e != nil {
+					return result, e
+				}
+			}
+		} else {
+			if richMenuId, e = b.deployRichMenu(menu, rb.Image, d.Alias); e != nil {
+				return result, e
+			}
+			result.Created = append(result.Created, d.Name)
+		}
+		result.RichMenuIds[d.Name] = richMenuId
+		isCurrent[richMenuId] = true
+
+		if d.Default {
+			if _, e := b.SetDefaultRichMenu(richMenuId).Do(); e != nil {
+				return result, e
+			}
+		}
+	}
+
+	//Remove replaced menus and menus no longer defined
+	for _, menu := range existing {
+		name, ok := richMenuDefinitionName(menu.Name)
+		if !ok {
+			continue //Not created by sync
+		}
+
+		if isCurrent[menu.RichMenuID] {
+			continue
+		}
+
+		if _, e := b.DeleteRichMenu(menu.RichMenuID).Do(); e != nil {
+			return result, e
+		}
+		result.Deleted = append(result.Deleted, name)
+	}
+
+	return result, nil
+}
+
+func (b *Bot) SyncRichMenusFromFile(path string) (*RichMenuSyncResult, error) {
+	defs, e := LoadRichMenuDefinitions(path)
+	if e != nil {
+		return nil, e
+	}
+
+	return b.SyncRichMenus(defs)
+}
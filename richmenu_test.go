@@ -0,0 +1,234 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRichMenuBuilder(t *testing.T) {
+	rb := NewRichMenuBuilder("main", "Menu", 2500, 1686)
+	grid := rb.Grid(2, 3)
+	grid.WithMessageAction("Hello", 0, 0)
+	grid.WithURIAction("https://example.com", 0, 1)
+	grid.WithPostbackAction("action=buy", "Buy", 0, 2)
+	grid.WithActionSpan(richMenuSwitchAction("settings", "menu=settings"), 1, 0, 1, 3)
+
+	menu, e := rb.Build()
+	assert.Nil(t, e)
+	assert.Equal(t, len(menu.Areas), 4)
+	assert.Equal(t, menu.Areas[0].Bounds, linebot.RichMenuBounds{0, 0, 833, 843})
+	assert.Equal(t, menu.Areas[1].Bounds, linebot.RichMenuBounds{833, 0, 834, 843})
+	assert.Equal(t, menu.Areas[2].Bounds, linebot.RichMenuBounds{1667, 0, 833, 843})
+	assert.Equal(t, menu.Areas[3].Bounds, linebot.RichMenuBounds{0, 843, 2500, 843})
+	assert.Equal(t, menu.Areas[3].Action.RichMenuAliasID, "settings")
+
+	rb.WithMessageAction("overlap", 0, 0, 100, 100)
+	_, e = rb.Build()
+	assert.Equal(t, e, ErrorAreaOverlap)
+
+	rb = NewRichMenuBuilder("main", "Menu", 2500, 843)
+	rb.WithMessageAction("outside", 2000, 0, 1000, 843)
+	_, e = rb.Build()
+	assert.Equal(t, e, ErrorAreaOutOfBounds)
+
+	rb = NewRichMenuBuilder("main", "Menu", 2500, 2500)
+	rb.WithMessageAction("square", 0, 0, 100, 100)
+	_, e = rb.Build()
+	assert.Equal(t, e, ErrorInvalidRichMenuSize)
+
+	rb = NewRichMenuBuilder("main", "A very long chat bar text", 2500, 843)
+	rb.WithMessageAction("hi", 0, 0, 100, 100)
+	_, e = rb.Build()
+	assert.Equal(t, e, ErrorTextExceedLimit)
+
+	rb = NewRichMenuBuilder("main", "Menu", 2500, 843)
+	_, e = rb.Build()
+	assert.Equal(t, e, ErrorNoAction)
+}
+
+type fakeRichMenuAPI struct {
+	lock     sync.Mutex
+	next     int
+	menus    map[string]*linebot.RichMenuResponse
+	aliases  map[string]string
+	images   map[string]bool
+	defaults string
+	calls    []string
+}
+
+func newFakeRichMenuAPI() *fakeRichMenuAPI {
+	return &fakeRichMenuAPI{
+		menus:   make(map[string]*linebot.RichMenuResponse),
+		aliases: make(map[string]string),
+		images:  make(map[string]bool),
+	}
+}
+
+func (f *fakeRichMenuAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path := req.URL.Path
+	f.calls = append(f.calls, req.Method+" "+path)
+	body, _ := ioutil.ReadAll(req.Body)
+
+	reply := func(v interface{}) {
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	switch {
+	case req.Method == "GET" && path == "/v2/bot/richmenu/list":
+		list := []*linebot.RichMenuResponse{}
+		for i := 0; i < f.next; i++ {
+			if menu, ok := f.menus[fmt.Sprintf("richmenu-%d", i)]; ok {
+				list = append(list, menu)
+			}
+		}
+		reply(map[string]interface{}{"richmenus": list})
+	case req.Method == "POST" && path == "/v2/bot/richmenu":
+		menu := &linebot.RichMenuResponse{}
+		json.Unmarshal(body, menu)
+		menu.RichMenuID = fmt.Sprintf("richmenu-%d", f.next)
+		f.next++
+		f.menus[menu.RichMenuID] = menu
+		reply(map[string]string{"richMenuId": menu.RichMenuID})
+	case req.Method == "POST" && strings.HasSuffix(path, "/content"):
+		f.images[strings.Split(path, "/")[4]] = true
+		reply(map[string]string{})
+	case req.Method == "DELETE" && strings.HasPrefix(path, "/v2/bot/richmenu/"):
+		delete(f.menus, strings.TrimPrefix(path, "/v2/bot/richmenu/"))
+		reply(map[string]string{})
+	case req.Method == "GET" && strings.HasPrefix(path, "/v2/bot/richmenu/alias/"):
+		alias := strings.TrimPrefix(path, "/v2/bot/richmenu/alias/")
+		if id, ok := f.aliases[alias]; ok {
+			reply(map[string]string{"richMenuAliasId": alias, "richMenuId": id})
+		} else {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"message":"Not found"}`))
+		}
+	case req.Method == "POST" && strings.HasPrefix(path, "/v2/bot/richmenu/alias"):
+		alias := &linebot.RichMenuAliasResponse{}
+		json.Unmarshal(body, alias)
+		if alias.RichMenuAliasID == "" {
+			alias.RichMenuAliasID = strings.TrimPrefix(path, "/v2/bot/richmenu/alias/")
+		}
+		f.aliases[alias.RichMenuAliasID] = alias.RichMenuID
+		reply(map[string]string{})
+	case req.Method == "POST" && strings.HasPrefix(path, "/v2/bot/user/all/richmenu/"):
+		f.defaults = strings.TrimPrefix(path, "/v2/bot/user/all/richmenu/")
+		reply(map[string]string{})
+	default:
+		w.WriteHeader(404)
+		w.Write([]byte(`{"message":"Not found"}`))
+	}
+}
+
+func TestSyncRichMenus(t *testing.T) {
+	api := newFakeRichMenuAPI()
+	server := httptest.NewTLSServer(api)
+	defer server.Close()
+
+	client, _ := mockClient(server)
+	bot, _ := NewBot("test", "test")
+	bot.Client = client
+
+	dir, _ := ioutil.TempDir("", "richmenu")
+	defer os.RemoveAll(dir)
+
+	f, _ := os.Create(filepath.Join(dir, "main.png"))
+	png.Encode(f, image.NewGray(image.Rect(0, 0, 2500, 843)))
+	f.Close()
+
+	definitions := `[
+		{
+			"name": "main", "chatBarText": "Menu", "width": 2500, "height": 843,
+			"image": "main.png", "alias": "main", "default": true, "rows": 1, "cols": 2,
+			"areas": [
+				{"row": 0, "col": 0, "action": {"type": "message", "text": "Hello"}},
+				{"row": 0, "col": 1, "action": {"type": "richmenuswitch", "richMenuAliasId": "settings", "data": "settings"}}
+			]
+		},
+		{
+			"name": "settings", "chatBarText": "Settings", "width": 2500, "height": 843, "alias": "settings",
+			"areas": [
+				{"x": 0, "y": 0, "width": 2500, "height": 843, "action": {"type": "richmenuswitch", "richMenuAliasId": "main", "data": "main"}}
+			]
+		}
+	]`
+	path := filepath.Join(dir, "menus.json")
+	ioutil.WriteFile(path, []byte(definitions), 0644)
+
+	//A menu created outside of sync is never touched
+	manual, _ := bot.CreateRichMenu(linebot.RichMenu{Name: "manual", ChatBarText: "Manual", Size: linebot.RichMenuSize{2500, 843}}).Do()
+
+	result, e := bot.SyncRichMenusFromFile(path)
+	assert.Nil(t, e)
+	assert.Equal(t, result.Created, []string{"main", "settings"})
+	assert.Equal(t, len(result.Deleted), 0)
+	mainId := result.RichMenuIds["main"]
+	assert.Equal(t, api.aliases["main"], mainId)
+	assert.Equal(t, api.aliases["settings"], result.RichMenuIds["settings"])
+	assert.Equal(t, api.defaults, mainId)
+	assert.True(t, api.images[mainId])
+	assert.Equal(t, len(api.menus), 3)
+
+	//Syncing again changes nothing
+	result, e = bot.SyncRichMenusFromFile(path)
+	assert.Nil(t, e)
+	assert.Equal(t, result.Created, []string{})
+	assert.Equal(t, result.Unchanged, []string{"main", "settings"})
+	assert.Equal(t, result.RichMenuIds["main"], mainId)
+	assert.Equal(t, len(api.menus), 3)
+
+	//Changed definitions are replaced and removed ones deleted
+	defs, _ := LoadRichMenuDefinitions(path)
+	defs[0].ChatBarText = "Open menu"
+	result, e = bot.SyncRichMenus(defs[:1])
+	assert.Nil(t, e)
+	assert.Equal(t, result.Created, []string{"main"})
+	assert.NotEqual(t, result.RichMenuIds["main"], mainId)
+	assert.Equal(t, api.aliases["main"], result.RichMenuIds["main"])
+	assert.Equal(t, result.Deleted, []string{"main", "settings"})
+	assert.Equal(t, len(api.menus), 2)
+	assert.NotNil(t, api.menus[manual.RichMenuID])
+}
+
+func TestSetRichMenuAliasError(t *testing.T) {
+	calls := []string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls = append(calls, req.Method+" "+req.URL.Path)
+		w.WriteHeader(500)
+		w.Write([]byte(`{"message":"Internal error"}`))
+	}))
+	defer server.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(server)
+
+	assert.NotNil(t, bot.SetRichMenuAlias("main", "richmenu-1"))
+	assert.Equal(t, calls, []string{"GET /v2/bot/richmenu/alias/main"})
+}
+
+func TestRichMenuSyncNameLength(t *testing.T) {
+	menu := linebot.RichMenu{Name: strings.Repeat("メ", 300)}
+	name := richMenuSyncName(menu, nil)
+	assert.Equal(t, len([]rune(name)), 300)
+
+	base, ok := richMenuDefinitionName(name)
+	assert.True(t, ok)
+	assert.Equal(t, base, strings.Repeat("メ", 286))
+}
@@ -0,0 +1,149 @@
+package lbotx
+
+import "sync/atomic"
+
+// Middleware wraps the event handlers registered through a Router
+type Middleware func(next EventHandler) EventHandler
+
+// middlewareVersion changes whenever middleware is added, so that wrapped handlers build
+// their chain again
+var middlewareVersion int64
+
+type middlewareChain struct {
+	version int64
+	handler EventHandler
+}
+
+// Router registers event handlers into the bot's handler chain. Scoped routers created by
+// InUserChat, InGroup, ForGroupID... only dispatch events of their source and run their own
+// middleware in addition to the middleware of their parents
+type Router struct {
+	bot         *Bot
+	table       *handlerTable
+	parent      *Router
+	filter      Predicate
+	middlewares []Middleware
+
+	name     string
+	priority int
+	claimed  bool //The name is taken by the first handler
+}
+
+// OnEvent registers handler. Scope filters of the router and its parents are checked before
+// any middleware runs; middleware of parents wraps middleware of their children
+func (r *Router) OnEvent(handler EventHandler) {
+	r.on(anyEvent, handler)
+}
+
+// on registers handler for events matching key only, so that the bot can skip it for
+// other events without calling it
+func (r *Router) on(key dispatchKey, handler EventHandler) {
+	r.add(handlerEntry{key: key}, handler)
+}
+
+// add registers handler with entry. The first handler of a named router takes its name,
+// every handler takes its priority
+func (r *Router) add(entry handlerEntry, handler EventHandler) {
+	for p := r; p != nil; p = p.parent {
+		if p.name != "" {
+			if !p.claimed {
+				entry.name, p.claimed = p.name, true
+			}
+			entry.priority = p.priority
+			break
+		}
+	}
+
+	entry.router = r
+	entry.handler = r.wrap(handler)
+	r.root().table.add(entry)
+}
+
+// wrap runs handler in the scope and middleware of the router and its parents
+func (r *Router) wrap(handler EventHandler) EventHandler {
+	routers := []*Router{}
+	for p := r; p != nil; p = p.parent {
+		routers = append([]*Router{p}, routers...)
+	}
+
+	var cached atomic.Value
+	return func(context *BotContext) (bool, error) {
+		for _, router := range routers {
+			if router.filter != nil && !router.filter(context) {
+				return true, nil //Out of scope. Continue.
+			}
+		}
+
+		//Built once, and again after Use
+		version := atomic.LoadInt64(&middlewareVersion)
+		chain, ok := cached.Load().(middlewareChain)
+		if !ok || chain.version != version {
+			chain = middlewareChain{version: version, handler: handler}
+			for i := len(routers) - 1; i >= 0; i-- {
+				middlewares := routers[i].middlewares
+				for j := len(middlewares) - 1; j >= 0; j-- {
+					chain.handler = middlewares[j](chain.handler)
+				}
+			}
+			cached.Store(chain)
+		}
+
+		return chain.handler(context)
+	}
+}
+
+func (r *Router) root() *Router {
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
+// Use adds middleware to every handler of this router, including ones registered before
+func (r *Router) Use(middlewares ...Middleware) *Router {
+	r.middlewares = append(r.middlewares, middlewares...)
+	atomic.AddInt64(&middlewareVersion, 1)
+	return r
+}
+
+// Scope returns a router whose handlers only see events accepted by filter
+func (r *Router) Scope(filter Predicate) *Router {
+	return &Router{
+		bot:    r.bot,
+		parent: r,
+		filter: filter,
+	}
+}
+
+func (r *Router) InUserChat() *Router {
+	return r.Scope(InUserChat())
+}
+
+func (r *Router) InGroup() *Router {
+	return r.Scope(InAnyGroup())
+}
+
+func (r *Router) InRoom() *Router {
+	return r.Scope(InAnyRoom())
+}
+
+func idSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func (r *Router) ForGroupID(groupIds ...string) *Router {
+	return r.Scope(InGroup(groupIds...))
+}
+
+func (r *Router) ForRoomID(roomIds ...string) *Router {
+	return r.Scope(InRoom(roomIds...))
+}
+
+// ForUserID scopes to events sent by the users, in 1:1 chats as well as in groups and rooms
+func (r *Router) ForUserID(userIds ...string) *Router {
+	return r.Scope(FromUser(userIds...))
+}
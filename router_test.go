@@ -0,0 +1,136 @@
+package lbotx
+
+import (
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func dispatch(bot *Bot, event *linebot.Event) *BotContext {
+	context := bot.NewContext(event)
+	for _, handler := range bot.table.lookup(event) {
+		next, e := handler(context)
+		if !next || e != nil {
+			break
+		}
+	}
+	return context
+}
+
+func textEvent(source *linebot.EventSource, text string) *linebot.Event {
+	return &linebot.Event{
+		Type:    linebot.EventTypeMessage,
+		Source:  source,
+		Message: &linebot.TextMessage{ID: "325708", Text: text},
+	}
+}
+
+func TestScopedRouters(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	trace := []string{}
+	bot.Use(func(next EventHandler) EventHandler {
+		return func(context *BotContext) (bool, error) {
+			trace = append(trace, "root")
+			return next(context)
+		}
+	})
+
+	groups := bot.InGroup()
+	groups.Use(func(next EventHandler) EventHandler {
+		return func(context *BotContext) (bool, error) {
+			trace = append(trace, "group")
+			return next(context)
+		}
+	})
+
+	bot.InUserChat().OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "user:"+text)
+		return false, nil
+	})
+
+	bot.ForGroupID("C1").OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "C1:"+text)
+		return false, nil
+	})
+
+	groups.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "group:"+text)
+		return false, nil
+	})
+
+	bot.InRoom().ForUserID("U2").OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "room U2:"+text)
+		return false, nil
+	})
+
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "hi"))
+	assert.Equal(t, trace, []string{"root", "user:hi"})
+
+	trace = []string{}
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C1", UserID: "U1"}, "hi"))
+	assert.Equal(t, trace, []string{"root", "C1:hi"})
+
+	trace = []string{}
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C2", UserID: "U1"}, "hi"))
+	assert.Equal(t, trace, []string{"root", "group", "group:hi"})
+
+	trace = []string{}
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: "R1", UserID: "U1"}, "hi"))
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: "R1", UserID: "U2"}, "hi"))
+	assert.Equal(t, trace, []string{"root", "room U2:hi"})
+}
+
+func TestForGroupIDWithoutIds(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	hits := 0
+	bot.ForGroupID().OnText(func(context *BotContext, text string) (bool, error) {
+		hits++
+		return true, nil
+	})
+	bot.ForRoomID().OnText(func(context *BotContext, text string) (bool, error) {
+		hits++
+		return true, nil
+	})
+
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C9", UserID: "U1"}, "hi"))
+	dispatch(bot, textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: "R9", UserID: "U1"}, "hi"))
+	assert.Equal(t, hits, 0)
+}
+
+func TestMiddlewareChainCached(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	built := 0
+	trace := []string{}
+	middleware := func(name string) Middleware {
+		return func(next EventHandler) EventHandler {
+			built++
+			return func(context *BotContext) (bool, error) {
+				trace = append(trace, name)
+				return next(context)
+			}
+		}
+	}
+
+	bot.Use(middleware("first"))
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		return true, nil
+	})
+
+	user := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+	dispatch(bot, textEvent(user, "hi"))
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, built, 1)
+	assert.Equal(t, trace, []string{"first", "first"})
+
+	//Middleware added later is picked up
+	trace = []string{}
+	bot.Use(middleware("second"))
+	dispatch(bot, textEvent(user, "hi"))
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, built, 3)
+	assert.Equal(t, trace, []string{"first", "second", "first", "second"})
+}
@@ -0,0 +1,103 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorUnknownHandler   = errors.New("No handler with this name")
+	ErrorDuplicateHandler = errors.New("Handler name is already taken")
+)
+
+var messageTypeNames = map[reflect.Type]linebot.MessageType{
+	textMessageType:     linebot.MessageTypeText,
+	imageMessageType:    linebot.MessageTypeImage,
+	videoMessageType:    linebot.MessageTypeVideo,
+	audioMessageType:    linebot.MessageTypeAudio,
+	fileMessageType:     linebot.MessageTypeFile,
+	locationMessageType: linebot.MessageTypeLocation,
+	stickerMessageType:  linebot.MessageTypeSticker,
+}
+
+// Route describes a handler in the effective chain. Empty EventType or MessageType means
+// the handler sees every event or message
+type Route struct {
+	Name        string              `json:"name,omitempty"`
+	Priority    int                 `json:"priority"`
+	EventType   linebot.EventType   `json:"eventType,omitempty"`
+	MessageType linebot.MessageType `json:"messageType,omitempty"`
+}
+
+// Named returns a router registering its first handler under name, to be replaced or removed
+// later. Handlers with higher priority run first, equal priorities run in registration order.
+// Names are unique in the bot and in each module
+func (r *Router) Named(name string, priority int) (*Router, error) {
+	if !r.root().table.reserve(name) {
+		return nil, ErrorDuplicateHandler
+	}
+
+	return &Router{
+		bot:      r.bot,
+		parent:   r,
+		name:     name,
+		priority: priority,
+	}, nil
+}
+
+// RemoveHandler removes the handler registered under name, in the bot or in a mounted
+// module. Events being handled finish with the chain they started with. A removed module
+// can be mounted again, and a name reserved by Named without any handler is freed
+func (b *Bot) RemoveHandler(name string) error {
+	table, entry := b.table.find(name)
+	if table == nil {
+		if b.table.release(name) {
+			return nil
+		}
+		return ErrorUnknownHandler
+	}
+	if !table.remove(name) {
+		return ErrorUnknownHandler
+	}
+
+	if entry.module != nil {
+		entry.module.mounted = false
+	}
+	return nil
+}
+
+// ReplaceHandler swaps the handler registered under name. The new handler keeps the
+// priority, scope and middleware of the old one and gets the events the old one got
+func (b *Bot) ReplaceHandler(name string, handler EventHandler) error {
+	table, entry := b.table.find(name)
+	if table == nil || !table.replace(name, entry.router.wrap(handler)) {
+		return ErrorUnknownHandler
+	}
+	return nil
+}
+
+// Routes lists the handler chain in the order events go through it
+func (b *Bot) Routes() []Route {
+	routes := []Route{}
+	for _, entry := range b.table.snapshot() {
+		routes = append(routes, Route{
+			Name:        entry.name,
+			Priority:    entry.priority,
+			EventType:   entry.key.eventType,
+			MessageType: messageTypeNames[entry.key.messageType],
+		})
+	}
+	return routes
+}
+
+// RoutesHandler serves Routes as json, for debugging. Don't expose it publicly
+func (b *Bot) RoutesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b.Routes())
+	})
+}
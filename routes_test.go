@@ -0,0 +1,153 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamedHandlers(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	trace := []string{}
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "anonymous")
+		return true, nil
+	})
+	echo, _ := bot.Named("echo", 0)
+	echo.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "echo:"+text)
+		return true, nil
+	})
+	audit, _ := bot.Named("audit", 10)
+	audit.OnEvent(func(context *BotContext) (bool, error) {
+		trace = append(trace, "audit")
+		return true, nil
+	})
+	group, _ := bot.InGroup().Named("group", 0)
+	group.OnFollow(func(context *BotContext) (bool, error) {
+		trace = append(trace, "group follow")
+		return true, nil
+	})
+
+	assert.Equal(t, bot.Routes(), []Route{
+		{Name: "audit", Priority: 10},
+		{Priority: 0, EventType: linebot.EventTypeMessage, MessageType: linebot.MessageTypeText},
+		{Name: "echo", Priority: 0, EventType: linebot.EventTypeMessage, MessageType: linebot.MessageTypeText},
+		{Name: "group", Priority: 0, EventType: linebot.EventTypeFollow},
+	})
+
+	user := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, trace, []string{"audit", "anonymous", "echo:hi"})
+
+	//Names are unique, handlers are replaced in place
+	_, e := bot.Named("echo", 0)
+	assert.Equal(t, e, ErrorDuplicateHandler)
+	assert.Nil(t, bot.ReplaceHandler("echo", func(context *BotContext) (bool, error) {
+		trace = append(trace, "echo2:"+context.Event.Message.(*linebot.TextMessage).Text)
+		return true, nil
+	}))
+	assert.Equal(t, len(bot.Routes()), 4)
+
+	trace = []string{}
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, trace, []string{"audit", "anonymous", "echo2:hi"})
+
+	//Replaced handler keeps the group scope
+	assert.Nil(t, bot.ReplaceHandler("group", func(context *BotContext) (bool, error) {
+		trace = append(trace, "group follow 2")
+		return true, nil
+	}))
+	assert.Equal(t, bot.ReplaceHandler("unknown", nil), ErrorUnknownHandler)
+
+	trace = []string{}
+	dispatch(bot, &linebot.Event{Type: linebot.EventTypeFollow, Source: user})
+	dispatch(bot, &linebot.Event{Type: linebot.EventTypeFollow, Source: &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C1"}})
+	assert.Equal(t, trace, []string{"audit", "audit", "group follow 2"})
+
+	assert.Nil(t, bot.RemoveHandler("audit"))
+	assert.Equal(t, bot.RemoveHandler("audit"), ErrorUnknownHandler)
+
+	trace = []string{}
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, trace, []string{"anonymous", "echo2:hi"})
+
+	//Only the first handler of a named router takes the name
+	admin, _ := bot.Named("admin", 5)
+	admin.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "admin text")
+		return true, nil
+	})
+	admin.OnFollow(func(context *BotContext) (bool, error) {
+		trace = append(trace, "admin follow")
+		return true, nil
+	})
+	assert.Equal(t, bot.Routes()[:2], []Route{
+		{Name: "admin", Priority: 5, EventType: linebot.EventTypeMessage, MessageType: linebot.MessageTypeText},
+		{Priority: 5, EventType: linebot.EventTypeFollow},
+	})
+
+	trace = []string{}
+	dispatch(bot, textEvent(user, "hi"))
+	dispatch(bot, &linebot.Event{Type: linebot.EventTypeFollow, Source: user})
+	assert.Equal(t, trace, []string{"admin text", "anonymous", "echo2:hi", "admin follow"})
+
+	assert.Nil(t, bot.RemoveHandler("admin"))
+	_, e = bot.Named("admin", 5)
+	assert.Nil(t, e)
+
+	recorder := httptest.NewRecorder()
+	bot.RoutesHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/routes", nil))
+	routes := []Route{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &routes))
+	assert.Equal(t, routes, bot.Routes())
+	assert.Equal(t, recorder.Header().Get("Content-Type"), "application/json")
+}
+
+func TestModuleHandlerNames(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	trace := []string{}
+	shop := NewModule("shop")
+	checkout, _ := shop.Named("checkout", 0)
+	checkout.OnText(func(context *BotContext, text string) (bool, error) {
+		trace = append(trace, "checkout")
+		return true, nil
+	})
+	assert.Nil(t, bot.Mount("shop", shop))
+
+	user := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+	assert.Nil(t, bot.ReplaceHandler("checkout", func(context *BotContext) (bool, error) {
+		trace = append(trace, "checkout 2")
+		return true, nil
+	}))
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, trace, []string{"checkout 2"})
+
+	assert.Nil(t, bot.RemoveHandler("checkout"))
+	assert.Equal(t, bot.RemoveHandler("checkout"), ErrorUnknownHandler)
+
+	trace = []string{}
+	dispatch(bot, textEvent(user, "hi"))
+	assert.Equal(t, trace, []string{})
+
+	//A removed module can be mounted again
+	assert.Nil(t, bot.RemoveHandler("module:shop"))
+	assert.Nil(t, bot.Mount("shop", shop))
+	assert.Equal(t, bot.Mount("shop", shop), ErrorModuleMounted)
+
+	//Names reserved without a handler can be freed
+	_, e := bot.Named("unused", 0)
+	assert.Nil(t, e)
+	_, e = shop.Named("unused", 0)
+	assert.Nil(t, e)
+	assert.Nil(t, bot.RemoveHandler("unused"))
+	assert.Nil(t, bot.RemoveHandler("unused"))
+	assert.Equal(t, bot.RemoveHandler("unused"), ErrorUnknownHandler)
+	_, e = bot.Named("unused", 0)
+	assert.Nil(t, e)
+}
@@ -0,0 +1,459 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorUnknownSchedule = errors.New("No scheduled job with this id")
+)
+
+// Clock tells the scheduler what time it is. Tests can give it a fake one
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ScheduledJob pushes Messages to To at Next. Jobs with a Cron spec are rescheduled after
+// each run, others are removed. A run in progress has a Run id, the retry keys of the
+// recipients it has not reached yet and the times it was attempted
+type ScheduledJob struct {
+	ID        string            `json:"id"`
+	To        []string          `json:"to"`
+	Messages  []json.RawMessage `json:"messages"`
+	Cron      string            `json:"cron,omitempty"`
+	Location  string            `json:"location,omitempty"`
+	Next      time.Time         `json:"next"`
+	Run       string            `json:"run,omitempty"`
+	RetryKeys map[string]string `json:"retryKeys,omitempty"`
+	Attempts  int               `json:"attempts,omitempty"`
+	Dead      bool              `json:"dead,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+}
+
+// ScheduleStore keeps scheduled jobs. Save adds or replaces a job
+type ScheduleStore interface {
+	Save(job ScheduledJob) error
+	Delete(id string) error
+	Jobs() ([]ScheduledJob, error)
+}
+
+type memoryScheduleStore struct {
+	lock sync.Mutex
+	jobs map[string]ScheduledJob
+}
+
+func NewMemoryScheduleStore() ScheduleStore {
+	return &memoryScheduleStore{jobs: make(map[string]ScheduledJob)}
+}
+
+func (s *memoryScheduleStore) Save(job ScheduledJob) error {
+	s.lock.Lock()
+	s.jobs[job.ID] = job
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *memoryScheduleStore) Delete(id string) error {
+	s.lock.Lock()
+	delete(s.jobs, id)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *memoryScheduleStore) Jobs() ([]ScheduledJob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs := []ScheduledJob{}
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+type scheduleRecord struct {
+	Op  string        `json:"op"`
+	Job *ScheduledJob `json:"job,omitempty"`
+	ID  string        `json:"id,omitempty"`
+}
+
+// FileScheduleStore keeps jobs in an append only file like FileOutboxStore
+type FileScheduleStore struct {
+	*jsonLog
+	jobs *memoryScheduleStore
+}
+
+func NewFileScheduleStore(path string) (*FileScheduleStore, error) {
+	s := &FileScheduleStore{
+		jobs: &memoryScheduleStore{jobs: make(map[string]ScheduledJob)},
+	}
+
+	log, e := openJSONLog(path, func(line []byte) error {
+		record := scheduleRecord{}
+		if e := json.Unmarshal(line, &record); e != nil {
+			return e
+		}
+
+		switch record.Op {
+		case "save":
+			if record.Job == nil {
+				return nil //Broken record, dropped like a cut line
+			}
+			s.jobs.Save(*record.Job)
+		case "delete":
+			s.jobs.Delete(record.ID)
+		}
+		return nil
+	}, s.records)
+	if e != nil {
+		return nil, e
+	}
+	s.jsonLog = log
+
+	return s, nil
+}
+
+func (s *FileScheduleStore) Save(job ScheduledJob) error {
+	return s.write(scheduleRecord{Op: "save", Job: &job}, func() error {
+		return s.jobs.Save(job)
+	})
+}
+
+func (s *FileScheduleStore) Delete(id string) error {
+	return s.write(scheduleRecord{Op: "delete", ID: id}, func() error {
+		return s.jobs.Delete(id)
+	})
+}
+
+func (s *FileScheduleStore) Jobs() ([]ScheduledJob, error) {
+	return s.jobs.Jobs()
+}
+
+// records are the jobs left
+func (s *FileScheduleStore) records() []interface{} {
+	jobs, _ := s.jobs.Jobs()
+
+	records := []interface{}{}
+	for i := range jobs {
+		records = append(records, scheduleRecord{Op: "save", Job: &jobs[i]})
+	}
+	return records
+}
+
+// Scheduler pushes messages at given times or on cron schedules. Due jobs are sent with a
+// PostMan, or handed to Outbox when it is set. Runs still failing after MaxAttempts become
+// dead letters, and the job goes on with its schedule
+type Scheduler struct {
+	Store  ScheduleStore
+	Clock  Clock
+	Outbox *Outbox
+	// Retry applies within one run of a job. Recipients left are tried again by RunDue
+	Retry       RetryPolicy
+	MaxAttempts int
+
+	bot  *Bot
+	lock sync.Mutex
+}
+
+func (b *Bot) NewScheduler(store ScheduleStore) *Scheduler {
+	return &Scheduler{
+		Store:       store,
+		Clock:       systemClock{},
+		Retry:       DefaultRetryPolicy,
+		MaxAttempts: 5,
+		bot:         b,
+	}
+}
+
+func (s *Scheduler) add(job ScheduledJob, tos []string, messages []linebot.Message) (string, error) {
+	job.ID = newRetryKey()
+	job.To = tos
+
+	for _, message := range messages {
+		data, e := json.Marshal(message)
+		if e != nil {
+			return "", e
+		}
+		job.Messages = append(job.Messages, data)
+	}
+
+	return job.ID, s.Store.Save(job)
+}
+
+// At pushes messages to tos once at t
+func (s *Scheduler) At(t time.Time, tos []string, messages ...linebot.Message) (string, error) {
+	return s.add(ScheduledJob{Next: t}, tos, messages)
+}
+
+// In pushes messages to tos once after d, e.g. in 10 minutes
+func (s *Scheduler) In(d time.Duration, tos []string, messages ...linebot.Message) (string, error) {
+	return s.At(s.Clock.Now().Add(d), tos, messages...)
+}
+
+// Every pushes messages to tos on a cron spec in location, e.g. "0 9 * * 1" for every
+// Monday 9:00. A nil location is UTC
+func (s *Scheduler) Every(spec string, location *time.Location, tos []string, messages ...linebot.Message) (string, error) {
+	cron, e := parseCron(spec)
+	if e != nil {
+		return "", e
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	next := cron.Next(s.Clock.Now().In(location))
+	if next.IsZero() {
+		return "", ErrorInvalidCron
+	}
+
+	return s.add(ScheduledJob{Cron: spec, Location: location.String(), Next: next}, tos, messages)
+}
+
+// Cancel removes a job. It waits for a RunDue in progress, so a run can't save it back
+func (s *Scheduler) Cancel(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs, e := s.Store.Jobs()
+	if e != nil {
+		return e
+	}
+
+	for _, job := range jobs {
+		if job.ID == id {
+			return s.Store.Delete(id)
+		}
+	}
+	return ErrorUnknownSchedule
+}
+
+func (s *Scheduler) Jobs() ([]ScheduledJob, error) {
+	return s.Store.Jobs()
+}
+
+// RunDue sends every job due by now and runs left unfinished. A cron job missed while the
+// process was down runs once and goes on from now. It returns the first error, after trying
+// every job
+func (s *Scheduler) RunDue() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs, e := s.Store.Jobs()
+	if e != nil {
+		return e
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Next.Before(jobs[j].Next)
+	})
+
+	now := s.Clock.Now()
+	var first error
+	for _, job := range jobs {
+		if job.Dead || job.Next.After(now) && job.Run == "" {
+			continue
+		}
+
+		if e := s.run(job, now); e != nil && first == nil {
+			first = e
+		}
+	}
+	return first
+}
+
+func (s *Scheduler) run(job ScheduledJob, now time.Time) error {
+	if job.Run == "" {
+		if e := s.start(&job, now); e != nil {
+			return e
+		}
+	}
+
+	sent := s.send(&job)
+	if len(job.RetryKeys) > 0 {
+		job.Attempts++
+		if job.Attempts < s.MaxAttempts {
+			if e := s.Store.Save(job); e != nil {
+				return e
+			}
+			return sent //Tried again by the next RunDue
+		}
+
+		//The run is given up on under its run id, the job itself goes on
+		dead := job
+		dead.ID, dead.Cron, dead.Dead = job.Run, "", true
+		if sent != nil {
+			dead.Reason = sent.Error()
+		}
+		if e := s.Store.Save(dead); e != nil {
+			return e
+		}
+	}
+
+	job.Run, job.RetryKeys, job.Attempts = "", nil, 0
+	var e error
+	if job.Cron == "" || job.Next.IsZero() {
+		e = s.Store.Delete(job.ID)
+	} else {
+		e = s.Store.Save(job)
+	}
+	if e != nil {
+		return e
+	}
+	return sent
+}
+
+// start saves a new run with the retry keys of the recipients and the next time of cron
+// jobs before anything is sent. A run cut by a crash goes on with the same keys, so it
+// neither runs twice nor delivers twice
+func (s *Scheduler) start(job *ScheduledJob, now time.Time) error {
+	job.Run = newRetryKey()
+	job.RetryKeys = make(map[string]string)
+	for _, to := range job.To {
+		job.RetryKeys[to] = newRetryKey()
+	}
+
+	if job.Cron != "" {
+		cron, e := parseCron(job.Cron)
+		if e != nil {
+			return e
+		}
+		location, e := time.LoadLocation(job.Location)
+		if e != nil {
+			return e
+		}
+		job.Next = cron.Next(now.In(location))
+	}
+
+	return s.Store.Save(*job)
+}
+
+// send pushes to the recipients left in the run and removes them from RetryKeys once
+// reached, or failed with errors that can't be retried
+func (s *Scheduler) send(job *ScheduledJob) error {
+	pending := []string{}
+	for _, to := range job.To {
+		if _, ok := job.RetryKeys[to]; ok {
+			pending = append(pending, to)
+		}
+	}
+
+	if s.Outbox != nil {
+		retryKeys := make(map[string]string)
+		for _, to := range pending {
+			retryKeys[to] = job.RetryKeys[to]
+		}
+
+		//Saved under the run id, enqueueing the run again replaces it
+		e := s.Outbox.Store.Save(OutboxJob{
+			ID:        job.Run,
+			To:        pending,
+			Messages:  job.Messages,
+			RetryKeys: retryKeys,
+			CreatedAt: s.Clock.Now(),
+		})
+		if e == nil {
+			job.RetryKeys = nil
+		}
+		return e
+	}
+
+	pm := s.bot.NewPostMan().WithRetryPolicy(s.Retry)
+	for _, message := range job.Messages {
+		pm.messages = append(pm.messages, rawMessage(message))
+	}
+
+	retryKeys := make(map[string]string)
+	var first error
+	for _, to := range pending {
+		outcome := pm.withRetry(to, job.RetryKeys[to], func(retryKey string) error {
+			return pm.push(to, retryKey)
+		})
+		if outcome.Err == nil {
+			continue
+		}
+
+		if first == nil {
+			first = outcome.Err
+		}
+		if IsRetryable(outcome.Err) {
+			retryKeys[to] = job.RetryKeys[to]
+		}
+	}
+	job.RetryKeys = retryKeys
+	return first
+}
+
+// DeadLetters returns runs given up on, with the recipients left and the last failure
+func (s *Scheduler) DeadLetters() ([]ScheduledJob, error) {
+	jobs, e := s.Store.Jobs()
+	if e != nil {
+		return nil, e
+	}
+
+	dead := []ScheduledJob{}
+	for _, job := range jobs {
+		if job.Dead {
+			dead = append(dead, job)
+		}
+	}
+	return dead, nil
+}
+
+// Requeue makes a dead run due again with its attempts reset. It keeps its retry keys
+func (s *Scheduler) Requeue(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs, e := s.Store.Jobs()
+	if e != nil {
+		return e
+	}
+
+	for _, job := range jobs {
+		if job.ID == id && job.Dead {
+			job.Dead = false
+			job.Attempts = 0
+			job.Reason = ""
+			return s.Store.Save(job)
+		}
+	}
+	return ErrorUnknownSchedule
+}
+
+// Start runs due jobs every interval until stop is called
+func (s *Scheduler) Start(interval time.Duration, onError func(e error)) (stop func()) {
+	done := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if e := s.RunDue(); e != nil && onError != nil {
+					onError(e)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
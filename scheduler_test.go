@@ -0,0 +1,253 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestScheduler(t *testing.T) {
+	pushed := []string{}
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body := struct {
+			To       string `json:"to"`
+			Messages []struct {
+				Text string `json:"text"`
+			} `json:"messages"`
+		}{}
+		json.Unmarshal(data, &body)
+		pushed = append(pushed, body.To+":"+body.Messages[0].Text)
+
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	dir, _ := ioutil.TempDir("", "scheduler")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schedule.log")
+
+	taipei, _ := time.LoadLocation("Asia/Taipei")
+	clock := &fakeClock{time.Date(2024, 3, 8, 8, 0, 0, 0, taipei)} //Friday
+
+	store, _ := NewFileScheduleStore(path)
+	scheduler := bot.NewScheduler(store)
+	scheduler.Clock = clock
+
+	_, e := scheduler.In(10*time.Minute, []string{"U1"}, linebot.NewTextMessage("reminder"))
+	assert.Nil(t, e)
+	weekly, _ := scheduler.Every("0 9 * * 1", taipei, []string{"U1", "U2"}, linebot.NewTextMessage("weekly"))
+	cancelled, _ := scheduler.At(clock.now.Add(time.Hour), []string{"U3"}, linebot.NewTextMessage("cancelled"))
+	_, e = scheduler.Every("0 9 * *", taipei, []string{"U1"}, linebot.NewTextMessage("invalid"))
+	assert.Equal(t, e, ErrorInvalidCron)
+
+	assert.Nil(t, scheduler.Cancel(cancelled))
+	assert.Equal(t, scheduler.Cancel(cancelled), ErrorUnknownSchedule)
+
+	clock.now = clock.now.Add(5 * time.Minute)
+	assert.Nil(t, scheduler.RunDue())
+	assert.Equal(t, pushed, []string{})
+
+	clock.now = clock.now.Add(5 * time.Minute)
+	assert.Nil(t, scheduler.RunDue())
+	assert.Equal(t, pushed, []string{"U1:reminder"})
+	store.Close()
+
+	//Restart, the weekly job is still there
+	store, _ = NewFileScheduleStore(path)
+	scheduler = bot.NewScheduler(store)
+	scheduler.Clock = clock
+	jobs, _ := scheduler.Jobs()
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(t, jobs[0].ID, weekly)
+	assert.True(t, jobs[0].Next.Equal(time.Date(2024, 3, 11, 9, 0, 0, 0, taipei)))
+
+	//Monday 9:00 and a week later
+	pushed = []string{}
+	clock.now = time.Date(2024, 3, 11, 9, 0, 30, 0, taipei)
+	assert.Nil(t, scheduler.RunDue())
+	assert.Nil(t, scheduler.RunDue())
+	assert.Equal(t, pushed, []string{"U1:weekly", "U2:weekly"})
+
+	jobs, _ = scheduler.Jobs()
+	assert.True(t, jobs[0].Next.Equal(time.Date(2024, 3, 18, 9, 0, 0, 0, taipei)))
+
+	//Handed to the outbox when set
+	pushed = []string{}
+	scheduler.Outbox = bot.NewOutbox(NewMemoryOutboxStore())
+	clock.now = time.Date(2024, 3, 18, 9, 0, 0, 0, taipei)
+	assert.Nil(t, scheduler.RunDue())
+	assert.Equal(t, pushed, []string{})
+
+	assert.Nil(t, scheduler.Outbox.Deliver())
+	assert.Equal(t, pushed, []string{"U1:weekly", "U2:weekly"})
+	store.Close()
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	statuses := map[string]int{"U1": 500, "U2": 200, "U3": 400}
+	retryKeys := map[string][]string{}
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body := struct {
+			To string `json:"to"`
+		}{}
+		json.Unmarshal(data, &body)
+		retryKeys[body.To] = append(retryKeys[body.To], req.Header.Get("X-Line-Retry-Key"))
+
+		w.WriteHeader(statuses[body.To])
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	dir, _ := ioutil.TempDir("", "scheduler")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schedule.log")
+
+	clock := &fakeClock{time.Date(2024, 3, 8, 8, 0, 0, 0, time.UTC)}
+	store, _ := NewFileScheduleStore(path)
+	scheduler := bot.NewScheduler(store)
+	scheduler.Clock = clock
+	scheduler.Retry = NoRetry
+
+	id, _ := scheduler.At(clock.now, []string{"U1", "U2", "U3"}, linebot.NewTextMessage("reminder"))
+	assert.NotNil(t, scheduler.RunDue())
+
+	//U1 failed for now and is tried again, U3 can't be reached and is dropped
+	jobs, _ := scheduler.Jobs()
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(t, jobs[0].ID, id)
+	assert.Equal(t, jobs[0].RetryKeys, map[string]string{"U1": retryKeys["U1"][0]})
+	store.Close()
+
+	//Restart, the run goes on with the same retry key
+	store, _ = NewFileScheduleStore(path)
+	defer store.Close()
+	scheduler = bot.NewScheduler(store)
+	scheduler.Clock = clock
+	scheduler.Retry = NoRetry
+
+	statuses["U1"] = 200
+	assert.Nil(t, scheduler.RunDue())
+	assert.Equal(t, retryKeys["U1"][0], retryKeys["U1"][1])
+	assert.Equal(t, len(retryKeys["U2"]), 1)
+	assert.Equal(t, len(retryKeys["U3"]), 1)
+
+	jobs, _ = scheduler.Jobs()
+	assert.Equal(t, len(jobs), 0)
+
+	//A cron job is rescheduled before sending
+	weekly, _ := scheduler.Every("0 9 * * 1", time.UTC, []string{"U1"}, linebot.NewTextMessage("weekly"))
+	clock.now = time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	statuses["U1"] = 500
+	assert.NotNil(t, scheduler.RunDue())
+
+	jobs, _ = scheduler.Jobs()
+	assert.Equal(t, jobs[0].ID, weekly)
+	assert.True(t, jobs[0].Next.Equal(time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)))
+	assert.NotEqual(t, jobs[0].Run, "")
+
+	statuses["U1"] = 200
+	assert.Nil(t, scheduler.RunDue())
+	jobs, _ = scheduler.Jobs()
+	assert.Equal(t, jobs[0].Run, "")
+	assert.True(t, jobs[0].Next.Equal(time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)))
+}
+
+func TestSchedulerMaxAttempts(t *testing.T) {
+	status := 500
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	clock := &fakeClock{time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)}
+	scheduler := bot.NewScheduler(NewMemoryScheduleStore())
+	scheduler.Clock = clock
+	scheduler.Retry = NoRetry
+	scheduler.MaxAttempts = 2
+
+	weekly, _ := scheduler.Every("0 9 * * 1", time.UTC, []string{"U1"}, linebot.NewTextMessage("weekly"))
+	clock.now = time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)
+	assert.NotNil(t, scheduler.RunDue())
+	assert.NotNil(t, scheduler.RunDue())
+
+	//The run is a dead letter, the job waits for its next time
+	dead, _ := scheduler.DeadLetters()
+	assert.Equal(t, len(dead), 1)
+	assert.NotEqual(t, dead[0].ID, weekly)
+	assert.Equal(t, dead[0].Attempts, 2)
+	assert.Equal(t, len(dead[0].RetryKeys), 1)
+
+	jobs, _ := scheduler.Jobs()
+	assert.Equal(t, len(jobs), 2)
+	assert.Nil(t, scheduler.RunDue())
+
+	status = 200
+	assert.Equal(t, scheduler.Requeue(weekly), ErrorUnknownSchedule)
+	assert.Nil(t, scheduler.Requeue(dead[0].ID))
+	assert.Nil(t, scheduler.RunDue())
+
+	jobs, _ = scheduler.Jobs()
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(t, jobs[0].ID, weekly)
+	assert.Equal(t, jobs[0].Run, "")
+}
+
+func TestSchedulerCancelWhileRunning(t *testing.T) {
+	var scheduler *Scheduler
+	var id string
+	cancelled := make(chan error, 1)
+
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		go func() {
+			cancelled <- scheduler.Cancel(id)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	clock := &fakeClock{time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)}
+	scheduler = bot.NewScheduler(NewMemoryScheduleStore())
+	scheduler.Clock = clock
+
+	id, _ = scheduler.Every("0 9 * * *", time.UTC, []string{"U1"}, linebot.NewTextMessage("daily"))
+	clock.now = time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	assert.Nil(t, scheduler.RunDue())
+	assert.Nil(t, <-cancelled)
+
+	jobs, _ := scheduler.Jobs()
+	assert.Equal(t, len(jobs), 0)
+}
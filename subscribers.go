@@ -0,0 +1,388 @@
+package lbotx
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+var (
+	ErrorUnknownSubscriber = errors.New("No subscriber with this user id")
+)
+
+// Subscriber is a user who followed the bot. Unfollowed users are kept with Following
+// false, their tags and attributes are there again if they follow back
+type Subscriber struct {
+	UserID           string                 `json:"userId"`
+	Following        bool                   `json:"following"`
+	FollowedAt       time.Time              `json:"followedAt"`
+	UnfollowedAt     time.Time              `json:"unfollowedAt,omitempty"`
+	Profile          *UserProfile           `json:"profile,omitempty"`
+	ProfileFetchedAt time.Time              `json:"profileFetchedAt,omitempty"`
+	Tags             []string               `json:"tags,omitempty"`
+	Attributes       map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func (s *Subscriber) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Subscriber) clone() Subscriber {
+	s.Tags = append([]string{}, s.Tags...)
+
+	attributes := make(map[string]interface{})
+	for k, v := range s.Attributes {
+		attributes[k] = v
+	}
+	s.Attributes = attributes
+	return s
+}
+
+// SubscriberStore keeps subscribers. Get returns nil for unknown users, Save adds or
+// replaces a subscriber
+type SubscriberStore interface {
+	Get(userId string) (*Subscriber, error)
+	Save(s Subscriber) error
+	Subscribers() ([]Subscriber, error)
+}
+
+type memorySubscriberStore struct {
+	lock        sync.RWMutex
+	subscribers map[string]Subscriber
+}
+
+func NewMemorySubscriberStore() SubscriberStore {
+	return &memorySubscriberStore{subscribers: make(map[string]Subscriber)}
+}
+
+func (ms *memorySubscriberStore) Get(userId string) (*Subscriber, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	s, ok := ms.subscribers[userId]
+	if !ok {
+		return nil, nil
+	}
+	s = s.clone()
+	return &s, nil
+}
+
+func (ms *memorySubscriberStore) Save(s Subscriber) error {
+	ms.lock.Lock()
+	ms.subscribers[s.UserID] = s.clone()
+	ms.lock.Unlock()
+	return nil
+}
+
+func (ms *memorySubscriberStore) Subscribers() ([]Subscriber, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	subscribers := []Subscriber{}
+	for _, s := range ms.subscribers {
+		subscribers = append(subscribers, s.clone())
+	}
+	return subscribers, nil
+}
+
+// FileSubscriberStore keeps subscribers in an append only file like FileOutboxStore
+type FileSubscriberStore struct {
+	*jsonLog
+	subscribers *memorySubscriberStore
+}
+
+func NewFileSubscriberStore(path string) (*FileSubscriberStore, error) {
+	fs := &FileSubscriberStore{
+		subscribers: &memorySubscriberStore{subscribers: make(map[string]Subscriber)},
+	}
+
+	log, e := openJSONLog(path, func(line []byte) error {
+		s := Subscriber{}
+		if e := json.Unmarshal(line, &s); e != nil {
+			return e
+		}
+		return fs.subscribers.Save(s)
+	}, fs.records)
+	if e != nil {
+		return nil, e
+	}
+	fs.jsonLog = log
+
+	return fs, nil
+}
+
+func (fs *FileSubscriberStore) Get(userId string) (*Subscriber, error) {
+	return fs.subscribers.Get(userId)
+}
+
+func (fs *FileSubscriberStore) Save(s Subscriber) error {
+	return fs.write(s, func() error {
+		return fs.subscribers.Save(s)
+	})
+}
+
+func (fs *FileSubscriberStore) Subscribers() ([]Subscriber, error) {
+	return fs.subscribers.Subscribers()
+}
+
+// records are the latest record of each subscriber
+func (fs *FileSubscriberStore) records() []interface{} {
+	subscribers, _ := fs.subscribers.Subscribers()
+
+	records := []interface{}{}
+	for _, s := range subscribers {
+		records = append(records, s)
+	}
+	return records
+}
+
+// Subscribers records follow and unfollow events before handlers run, with the profile of
+// the user cached for ProfileTTL
+type Subscribers struct {
+	Store      SubscriberStore
+	Clock      Clock
+	ProfileTTL time.Duration
+
+	bot  *Bot
+	lock sync.Mutex
+}
+
+// Subscribers enables the subscriber registry with an in-memory store
+func (b *Bot) Subscribers() *Subscribers {
+	if b.subscribers == nil {
+		b.subscribers = &Subscribers{
+			Store:      NewMemorySubscriberStore(),
+			Clock:      systemClock{},
+			ProfileTTL: 24 * time.Hour,
+			bot:        b,
+		}
+	}
+	return b.subscribers
+}
+
+func (ss *Subscribers) onEvent(context *BotContext) error {
+	userId := context.GetUserId()
+	if userId == "" {
+		return nil
+	}
+
+	at := context.Event.Timestamp
+	if at.IsZero() {
+		at = ss.Clock.Now()
+	}
+
+	switch context.Event.Type {
+	case linebot.EventTypeFollow:
+		//Fetched before update locks the registry, other updates don't wait for LINE
+		profile, e := context.GetUser()
+		fetchedAt := ss.Clock.Now()
+
+		return ss.update(userId, true, func(s *Subscriber) error {
+			s.Following = true
+			s.FollowedAt = at
+			s.UnfollowedAt = time.Time{}
+
+			if e == nil {
+				s.Profile = profile
+				s.ProfileFetchedAt = fetchedAt
+			}
+			return nil
+		})
+	case linebot.EventTypeUnfollow:
+		return ss.update(userId, true, func(s *Subscriber) error {
+			s.Following = false
+			s.UnfollowedAt = at
+			return nil
+		})
+	}
+	return nil
+}
+
+// update applies change to the subscriber and saves it. Unknown users are created when
+// create is set, otherwise it fails with ErrorUnknownSubscriber
+func (ss *Subscribers) update(userId string, create bool, change func(s *Subscriber) error) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	s, e := ss.Store.Get(userId)
+	if e != nil {
+		return e
+	}
+	if s == nil {
+		if !create {
+			return ErrorUnknownSubscriber
+		}
+		s = &Subscriber{UserID: userId}
+	}
+
+	if e := change(s); e != nil {
+		return e
+	}
+	return ss.Store.Save(*s)
+}
+
+func (ss *Subscribers) Get(userId string) (*Subscriber, error) {
+	s, e := ss.Store.Get(userId)
+	if e != nil {
+		return nil, e
+	}
+	if s == nil {
+		return nil, ErrorUnknownSubscriber
+	}
+	return s, nil
+}
+
+func (ss *Subscribers) Tag(userId string, tags ...string) error {
+	return ss.update(userId, false, func(s *Subscriber) error {
+		for _, tag := range tags {
+			if !s.HasTag(tag) {
+				s.Tags = append(s.Tags, tag)
+			}
+		}
+		return nil
+	})
+}
+
+func (ss *Subscribers) Untag(userId string, tags ...string) error {
+	return ss.update(userId, false, func(s *Subscriber) error {
+		kept := []string{}
+		for _, t := range s.Tags {
+			removed := false
+			for _, tag := range tags {
+				removed = removed || t == tag
+			}
+			if !removed {
+				kept = append(kept, t)
+			}
+		}
+		s.Tags = kept
+		return nil
+	})
+}
+
+func (ss *Subscribers) SetAttribute(userId, name string, value interface{}) error {
+	return ss.update(userId, false, func(s *Subscriber) error {
+		if s.Attributes == nil {
+			s.Attributes = make(map[string]interface{})
+		}
+		s.Attributes[name] = value
+		return nil
+	})
+}
+
+// Attributes makes the registry a UserAttributeStore for PostMan templates
+func (ss *Subscribers) Attributes(userId string) (map[string]interface{}, error) {
+	s, e := ss.Store.Get(userId)
+	if e != nil || s == nil {
+		return nil, e
+	}
+	return s.Attributes, nil
+}
+
+// Profile returns the cached profile of the subscriber, fetched again when older than
+// ProfileTTL
+func (ss *Subscribers) Profile(userId string) (*UserProfile, error) {
+	s, e := ss.Get(userId)
+	if e != nil {
+		return nil, e
+	}
+	if s.Profile != nil && ss.Clock.Now().Sub(s.ProfileFetchedAt) < ss.ProfileTTL {
+		return s.Profile, nil
+	}
+
+	profile, e := fetchProfile(ss.bot.Client, userId)
+	if e != nil {
+		return nil, e
+	}
+
+	e = ss.update(userId, false, func(s *Subscriber) error {
+		s.Profile = profile
+		s.ProfileFetchedAt = ss.Clock.Now()
+		return nil
+	})
+	return profile, e
+}
+
+// SubscriberFilter selects subscribers having all Tags, followed from FollowedAfter and
+// before FollowedBefore. Zero times don't bound. Unfollowed users are left out unless
+// IncludeUnfollowed is set
+type SubscriberFilter struct {
+	Tags              []string
+	FollowedAfter     time.Time
+	FollowedBefore    time.Time
+	IncludeUnfollowed bool
+}
+
+func (f SubscriberFilter) match(s *Subscriber) bool {
+	if !s.Following && !f.IncludeUnfollowed {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !s.HasTag(tag) {
+			return false
+		}
+	}
+	if !f.FollowedAfter.IsZero() && s.FollowedAt.Before(f.FollowedAfter) {
+		return false
+	}
+	if !f.FollowedBefore.IsZero() && !s.FollowedAt.Before(f.FollowedBefore) {
+		return false
+	}
+	return true
+}
+
+// Find returns the subscribers matching filter in the order they followed
+func (ss *Subscribers) Find(filter SubscriberFilter) ([]Subscriber, error) {
+	subscribers, e := ss.Store.Subscribers()
+	if e != nil {
+		return nil, e
+	}
+
+	found := []Subscriber{}
+	for i := range subscribers {
+		if filter.match(&subscribers[i]) {
+			found = append(found, subscribers[i])
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].FollowedAt.Equal(found[j].FollowedAt) {
+			return found[i].UserID < found[j].UserID
+		}
+		return found[i].FollowedAt.Before(found[j].FollowedAt)
+	})
+	return found, nil
+}
+
+// IDs returns the user ids of the subscribers matching filter, e.g. for PostMan.Send
+func (ss *Subscribers) IDs(filter SubscriberFilter) ([]string, error) {
+	found, e := ss.Find(filter)
+	if e != nil {
+		return nil, e
+	}
+
+	ids := []string{}
+	for _, s := range found {
+		ids = append(ids, s.UserID)
+	}
+	return ids, nil
+}
+
+// Tagged returns the user ids of followers having all tags
+func (ss *Subscribers) Tagged(tags ...string) ([]string, error) {
+	return ss.IDs(SubscriberFilter{Tags: tags})
+}
+
+// FollowedBetween returns the user ids of followers who followed from from until to
+func (ss *Subscribers) FollowedBetween(from, to time.Time) ([]string, error) {
+	return ss.IDs(SubscriberFilter{FollowedAfter: from, FollowedBefore: to})
+}
@@ -0,0 +1,143 @@
+package lbotx
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func followEvent(eventType linebot.EventType, userId string, at time.Time) *linebot.Event {
+	return &linebot.Event{
+		Type:      eventType,
+		Timestamp: at,
+		Source: &linebot.EventSource{
+			Type:   linebot.EventSourceTypeUser,
+			UserID: userId,
+		},
+	}
+}
+
+func TestSubscribers(t *testing.T) {
+	profileCalls := 0
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		profileCalls++
+		w.WriteHeader(200)
+		w.Write([]byte(`{"userId":"U1","displayName":"John","language":"en"}`))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	dir, _ := ioutil.TempDir("", "subscribers")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subscribers.log")
+
+	store, _ := NewFileSubscriberStore(path)
+	clock := &fakeClock{time.Date(2024, 3, 8, 8, 0, 0, 0, time.UTC)}
+	subscribers := bot.Subscribers()
+	subscribers.Store = store
+	subscribers.Clock = clock
+
+	//Handlers see the subscriber already recorded
+	bot.OnFollow(func(context *BotContext) (bool, error) {
+		return true, subscribers.Tag(context.GetUserId(), "new")
+	})
+
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	bot.handleEvent(followEvent(linebot.EventTypeFollow, "U1", march))
+	bot.handleEvent(followEvent(linebot.EventTypeFollow, "U2", march.AddDate(0, 0, 10)))
+	bot.handleEvent(followEvent(linebot.EventTypeFollow, "U3", march.AddDate(0, 1, 0)))
+	bot.handleEvent(followEvent(linebot.EventTypeUnfollow, "U2", march.AddDate(0, 0, 20)))
+	assert.Equal(t, profileCalls, 3)
+
+	u1, _ := subscribers.Get("U1")
+	assert.True(t, u1.Following)
+	assert.True(t, u1.FollowedAt.Equal(march))
+	assert.Equal(t, u1.Profile.Name, "John")
+	assert.Equal(t, u1.Tags, []string{"new"})
+
+	u2, _ := subscribers.Get("U2")
+	assert.False(t, u2.Following)
+	assert.True(t, u2.UnfollowedAt.Equal(march.AddDate(0, 0, 20)))
+
+	_, e := subscribers.Get("U4")
+	assert.Equal(t, e, ErrorUnknownSubscriber)
+	assert.Equal(t, subscribers.Tag("U4", "vip"), ErrorUnknownSubscriber)
+
+	assert.Nil(t, subscribers.Tag("U1", "vip", "new"))
+	assert.Nil(t, subscribers.Tag("U3", "vip"))
+	assert.Nil(t, subscribers.Untag("U3", "new"))
+	assert.Nil(t, subscribers.SetAttribute("U1", "plan", "gold"))
+
+	ids, _ := subscribers.Tagged("vip")
+	assert.Equal(t, ids, []string{"U1", "U3"})
+	ids, _ = subscribers.Tagged("vip", "new")
+	assert.Equal(t, ids, []string{"U1"})
+	ids, _ = subscribers.FollowedBetween(march, march.AddDate(0, 1, 0))
+	assert.Equal(t, ids, []string{"U1"})
+	ids, _ = subscribers.IDs(SubscriberFilter{FollowedBefore: march.AddDate(0, 1, 0), IncludeUnfollowed: true})
+	assert.Equal(t, ids, []string{"U1", "U2"})
+
+	attributes, _ := subscribers.Attributes("U1")
+	assert.Equal(t, attributes, map[string]interface{}{"plan": "gold"})
+
+	//Profiles are cached for ProfileTTL
+	profile, _ := subscribers.Profile("U1")
+	assert.Equal(t, profile.Name, "John")
+	assert.Equal(t, profileCalls, 3)
+	clock.now = clock.now.Add(25 * time.Hour)
+	subscribers.Profile("U1")
+	assert.Equal(t, profileCalls, 4)
+
+	//Restart, everything is still there
+	assert.Nil(t, store.Compact())
+	store.Close()
+	store, _ = NewFileSubscriberStore(path)
+	defer store.Close()
+	subscribers.Store = store
+
+	ids, _ = subscribers.Tagged("vip")
+	assert.Equal(t, ids, []string{"U1", "U3"})
+	u1, _ = subscribers.Get("U1")
+	assert.Equal(t, u1.Attributes, map[string]interface{}{"plan": "gold"})
+	assert.True(t, u1.ProfileFetchedAt.Equal(clock.now))
+}
+
+func TestSubscribersFollowDoesNotBlock(t *testing.T) {
+	release := make(chan bool)
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.WriteHeader(200)
+		w.Write([]byte(`{"userId":"U1","displayName":"John","language":"en"}`))
+	}))
+	defer mockServer.Close()
+	defer close(release)
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+	subscribers := bot.Subscribers()
+	assert.Nil(t, subscribers.Store.Save(Subscriber{UserID: "U2", Following: true}))
+
+	//U1 waits for its profile while U2 is tagged
+	go bot.handleEvent(followEvent(linebot.EventTypeFollow, "U1", time.Now()))
+
+	tagged := make(chan error)
+	go func() {
+		tagged <- subscribers.Tag("U2", "vip")
+	}()
+
+	select {
+	case e := <-tagged:
+		assert.Nil(t, e)
+	case <-time.After(time.Second):
+		t.Error("Tag waited for the profile of another user")
+	}
+}
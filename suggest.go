@@ -0,0 +1,180 @@
+package lbotx
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+const maxSuggestions = 3
+
+// hint is a text the bot understands, collected from OnTextWith templates and module
+// commands for "did you mean" suggestions
+type hint struct {
+	text    string
+	literal string //Compared with what users type
+	prefix  bool   //Users type more after literal, like command args
+	fixed   bool   //text can be sent as is
+}
+
+func templateHint(template string) (hint, bool) {
+	idx := strings.Index(template, "{{")
+	if idx < 0 {
+		return hint{text: template, literal: template, fixed: true}, true
+	}
+
+	if strings.TrimSpace(template[:idx]) == "" {
+		return hint{}, false //Nothing to compare with
+	}
+	return hint{text: template, literal: template[:idx], prefix: true}, true
+}
+
+func commandHint(command string) hint {
+	return hint{text: command, literal: command, prefix: true, fixed: true}
+}
+
+// hints collects hints of the handlers in t and in the modules enabled for context, or
+// enabled everywhere without context. m is the module of t, if any
+func (t *handlerTable) hints(m *Module, context *BotContext) []hint {
+	hints := []hint{}
+	for _, entry := range t.snapshot() {
+		hints = append(hints, entry.hints...)
+		if entry.command != "" && m != nil {
+			hints = append(hints, commandHint(m.command(entry.command)))
+		}
+		if entry.module != nil && entry.module.enabledFor(context) {
+			hints = append(hints, entry.module.handlers.hints(entry.module, context)...)
+		}
+	}
+	return hints
+}
+
+// OnUnhandled adds a handler running when the chain finishes without error and without any
+// message to reply, e.g. bot.OnUnhandled(bot.DidYouMean("Did you mean?"))
+func (b *Bot) OnUnhandled(handler EventHandler) {
+	b.unhandledHandlers = append(b.unhandledHandlers, handler)
+}
+
+// editDistance counts insertions, deletions, substitutions and swaps of adjacent runes
+// turning a into b
+func editDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+func (b *Bot) suggest(context *BotContext, text string, max int) []hint {
+	input := []rune(strings.ToLower(strings.TrimSpace(text)))
+
+	type candidate struct {
+		hint     hint
+		distance int
+	}
+	candidates := []candidate{}
+
+	for _, h := range b.table.hints(nil, context) {
+		literal := []rune(strings.ToLower(h.literal))
+		compared := input
+		if h.prefix && len(compared) > len(literal) {
+			compared = compared[:len(literal)]
+		}
+
+		distance := editDistance(compared, literal)
+		if distance <= len(literal)/4 || distance <= 1 {
+			candidates = append(candidates, candidate{h, distance})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	hints := []hint{}
+	for _, c := range candidates {
+		if len(hints) == max {
+			break
+		}
+		hints = append(hints, c.hint)
+	}
+	return hints
+}
+
+// Suggest returns up to max registered commands and text templates closest to text
+func (b *Bot) Suggest(text string, max int) []string {
+	suggestions := []string{}
+	for _, h := range b.suggest(nil, text, max) {
+		suggestions = append(suggestions, h.text)
+	}
+	return suggestions
+}
+
+func quickReplyLabel(text string) string {
+	label := []rune(text)
+	if len(label) > 20 {
+		return string(label[:19]) + "…"
+	}
+	return text
+}
+
+// DidYouMean returns a fallback replying prompt and the closest commands or templates to
+// unhandled text messages. Suggestions without parameters become quick replies
+func (b *Bot) DidYouMean(prompt string) EventHandler {
+	return func(context *BotContext) (bool, error) {
+		if context.Event.Type != linebot.EventTypeMessage {
+			return true, nil
+		}
+
+		msg, ok := context.Event.Message.(*linebot.TextMessage)
+		if !ok {
+			return true, nil
+		}
+
+		hints := b.suggest(context, msg.Text, maxSuggestions)
+		if len(hints) == 0 {
+			return true, nil
+		}
+
+		text := prompt
+		buttons := []*linebot.QuickReplyButton{}
+		for _, h := range hints {
+			text += "\n" + h.text
+			if h.fixed {
+				buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageTemplateAction(quickReplyLabel(h.text), h.text)))
+			}
+		}
+
+		message := linebot.NewTextMessage(text)
+		if len(buttons) == 0 {
+			return false, context.Messages.AddMessage(message)
+		}
+		return false, context.Messages.AddMessage(message.WithQuickReplies(linebot.NewQuickReplyItems(buttons...)))
+	}
+}
@@ -0,0 +1,124 @@
+package lbotx
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, editDistance([]rune("help"), []rune("help")), 0)
+	assert.Equal(t, editDistance([]rune("hlep"), []rune("help")), 1)
+	assert.Equal(t, editDistance([]rune("kitten"), []rune("sitting")), 3)
+	assert.Equal(t, editDistance([]rune(""), []rune("abc")), 3)
+	assert.Equal(t, editDistance([]rune("天氣"), []rune("天気")), 1)
+}
+
+func TestSuggest(t *testing.T) {
+	bot, _ := NewBot("test", "test")
+
+	shop := NewModule("shop")
+	shop.OnCommand("buy", func(context *BotContext, args []string) (bool, error) {
+		return false, nil
+	})
+	shop.OnTextWith("price of {{item}}", func(context *BotContext, text string) (bool, error) {
+		return false, nil
+	})
+	bot.Mount("shop", shop)
+	shop.OnCommand("sell", func(context *BotContext, args []string) (bool, error) {
+		return false, nil
+	})
+
+	bot.OnTextWith("help", func(context *BotContext, text string) (bool, error) {
+		return false, nil
+	})
+	bot.OnTextWith("weather in {{city}}", func(context *BotContext, text string) (bool, error) {
+		return false, nil
+	})
+	bot.OnTextWith("{{anything}}!", func(context *BotContext, text string) (bool, error) {
+		return false, nil
+	})
+
+	assert.Equal(t, bot.Suggest("hlep", 3), []string{"help"})
+	assert.Equal(t, bot.Suggest("Wether in Tokyo", 3), []string{"weather in {{city}}"})
+	assert.Equal(t, bot.Suggest("/shop bye apple", 3), []string{"/shop buy"})
+	assert.Equal(t, bot.Suggest("/shop sel", 3), []string{"/shop sell"})
+	assert.Equal(t, bot.Suggest("prize of pear", 3), []string{"price of {{item}}"})
+	assert.Equal(t, bot.Suggest("good morning", 3), []string{})
+
+	//Hints go away with their handler or module
+	forecast, _ := bot.Named("forecast", 0)
+	forecast.OnTextWith("forecast", func(context *BotContext, text string) (bool, error) {
+		return false, nil
+	})
+	assert.Equal(t, bot.Suggest("forcast", 3), []string{"forecast"})
+	assert.Nil(t, bot.RemoveHandler("forecast"))
+	assert.Equal(t, bot.Suggest("forcast", 3), []string{})
+
+	shop.SetEnabled(false)
+	assert.Equal(t, bot.Suggest("/shop bye apple", 3), []string{})
+	shop.EnableFor("U1")
+	context := &BotContext{Event: textEvent(&linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}, "/shop bye apple")}
+	assert.Equal(t, len(bot.suggest(context, "/shop bye apple", 3)), 1)
+}
+
+func TestOnUnhandled(t *testing.T) {
+	replies := []string{}
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		replies = append(replies, string(data))
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	unhandled := 0
+	bot.OnUnhandled(func(context *BotContext) (bool, error) {
+		unhandled++
+		return true, nil
+	})
+	bot.OnUnhandled(bot.DidYouMean("Did you mean?"))
+
+	bot.OnTextWith("help", func(context *BotContext, text string) (bool, error) {
+		context.Messages.AddTextMessage("How can I help?")
+		return false, nil
+	})
+	bot.OnTextWith("weather in {{city}}", func(context *BotContext, text string) (bool, error) {
+		context.Messages.AddTextMessage("Sunny")
+		return false, nil
+	})
+
+	user := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+	event := textEvent(user, "help")
+	event.ReplyToken = "nHuyWiB7yP5Zw52FIkcQobQuGDXCTA"
+	bot.handleEvent(event)
+	assert.Equal(t, unhandled, 0)
+	assert.Equal(t, len(replies), 1)
+
+	event.Message = &linebot.TextMessage{ID: "325708", Text: "hlep"}
+	bot.handleEvent(event)
+	assert.Equal(t, unhandled, 1)
+	assert.Equal(t, len(replies), 2)
+	assert.True(t, strings.Contains(replies[1], `"text":"Did you mean?\nhelp"`))
+	assert.True(t, strings.Contains(replies[1], `"quickReply"`))
+
+	event.Message = &linebot.TextMessage{ID: "325708", Text: "wether in Tokyo"}
+	bot.handleEvent(event)
+	assert.Equal(t, unhandled, 2)
+	assert.True(t, strings.Contains(replies[2], `"text":"Did you mean?\nweather in {{city}}"`))
+	assert.False(t, strings.Contains(replies[2], `"quickReply"`))
+
+	//Nothing close, nothing to reply
+	event.Message = &linebot.TextMessage{ID: "325708", Text: "good morning"}
+	bot.handleEvent(event)
+	assert.Equal(t, unhandled, 3)
+	assert.Equal(t, len(replies), 3)
+}
@@ -0,0 +1,101 @@
+package lbotx
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+type callInfoKey struct{}
+
+// callInfo goes with an API call through Transport, which sets the retry key of the
+// request and writes back the request id of the response
+type callInfo struct {
+	retryKey  string
+	requestId string
+}
+
+// apiCall returns a context for an API call. The linebot client keeps retry keys for every
+// later call, so they are set per request by Transport instead
+func apiCall(retryKey string) (context.Context, *callInfo) {
+	info := &callInfo{retryKey: retryKey}
+	return context.WithValue(context.Background(), callInfoKey{}, info), info
+}
+
+type apiTransport struct {
+	base    http.RoundTripper
+	limiter atomic.Value //*RateLimiter
+	cb      atomic.Value //*CircuitBreaker
+}
+
+func (t *apiTransport) setLimiter(limiter *RateLimiter) {
+	t.limiter.Store(limiter)
+}
+
+func (t *apiTransport) setBreaker(cb *CircuitBreaker) {
+	t.cb.Store(cb)
+}
+
+func (t *apiTransport) breaker() *CircuitBreaker {
+	cb, _ := t.cb.Load().(*CircuitBreaker)
+	return cb
+}
+
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cb := t.breaker()
+	generation := 0
+	if cb != nil {
+		var e error
+		if generation, e = cb.allow(); e != nil {
+			return nil, e
+		}
+	}
+
+	if limiter, _ := t.limiter.Load().(*RateLimiter); limiter != nil {
+		if e := limiter.Wait(req.Context(), endpointCategory(req.URL.Path)); e != nil {
+			if cb != nil {
+				cb.abort(generation)
+			}
+			return nil, e
+		}
+	}
+
+	resp, e := t.send(req)
+
+	if cb != nil {
+		if e != nil && req.Context().Err() != nil {
+			cb.abort(generation) //Cancelled by the caller, says nothing about the API
+		} else {
+			cb.record(generation, e != nil || resp.StatusCode >= 500)
+		}
+	}
+	return resp, e
+}
+
+func (t *apiTransport) send(req *http.Request) (*http.Response, error) {
+	info, ok := req.Context().Value(callInfoKey{}).(*callInfo)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	if info.retryKey != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Line-Retry-Key", info.retryKey)
+	}
+
+	resp, e := t.base.RoundTrip(req)
+	if resp != nil {
+		info.requestId = resp.Header.Get("X-Line-Request-Id")
+	}
+	return resp, e
+}
+
+// Transport sets retry keys of pushes and records X-Line-Request-Id for APIError.
+// NewBotWithClient wraps the transport of your own http client with it, wrap it yourself
+// for linebot clients created without NewBot
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &apiTransport{base: base}
+}
@@ -0,0 +1,129 @@
+package lbotx
+
+import (
+	"errors"
+	"strings"
+)
+
+// UserFacingError is an error whose Message can be shown to users as is. Cause keeps the
+// internal details for OnError handlers
+type UserFacingError struct {
+	Message string
+	Cause   error
+}
+
+func (e *UserFacingError) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *UserFacingError) Unwrap() error {
+	return e.Cause
+}
+
+// UserError returns an error replied to the user as message when ReplyOnError is set
+func UserError(message string) error {
+	return &UserFacingError{Message: message}
+}
+
+func UserErrorWith(message string, cause error) error {
+	return &UserFacingError{Message: message, Cause: cause}
+}
+
+type errorMessage struct {
+	target   error
+	messages map[string]string
+}
+
+// ErrorReplies maps handler errors to replies in the user's language. User errors are
+// replied with their own message, known errors with their message, others with the apology
+type ErrorReplies struct {
+	DefaultLanguage string
+
+	apologies map[string]string
+	messages  []errorMessage
+}
+
+func NewErrorReplies(defaultLanguage, apology string) *ErrorReplies {
+	return &ErrorReplies{
+		DefaultLanguage: defaultLanguage,
+		apologies:       map[string]string{defaultLanguage: apology},
+	}
+}
+
+func (er *ErrorReplies) WithApology(language, apology string) *ErrorReplies {
+	er.apologies[language] = apology
+	return er
+}
+
+// WithErrorMessage replies message to users of language when a handler fails with target
+// or an error wrapping it
+func (er *ErrorReplies) WithErrorMessage(target error, language, message string) *ErrorReplies {
+	for _, m := range er.messages {
+		if m.target == target {
+			m.messages[language] = message
+			return er
+		}
+	}
+
+	er.messages = append(er.messages, errorMessage{target, map[string]string{language: message}})
+	return er
+}
+
+// localize picks the text for language, its base language ("zh" for "zh-Hant") or the
+// default language
+func (er *ErrorReplies) localize(texts map[string]string, language string) (string, bool) {
+	if text, ok := texts[language]; ok {
+		return text, true
+	}
+	if idx := strings.Index(language, "-"); idx > 0 {
+		if text, ok := texts[language[:idx]]; ok {
+			return text, true
+		}
+	}
+	text, ok := texts[er.DefaultLanguage]
+	return text, ok
+}
+
+// Message returns the reply for e to a user of language
+func (er *ErrorReplies) Message(language string, e error) string {
+	var userError *UserFacingError
+	if errors.As(e, &userError) {
+		return userError.Message
+	}
+
+	for _, m := range er.messages {
+		if errors.Is(e, m.target) {
+			if text, ok := er.localize(m.messages, language); ok {
+				return text
+			}
+		}
+	}
+
+	text, _ := er.localize(er.apologies, language)
+	return text
+}
+
+// cachedLanguage is the language of a profile fetched already, "" if there is none. Error
+// replies don't fetch profiles, the error may well be that the API is down
+func (b *Bot) cachedLanguage(context *BotContext) string {
+	if context.userProfile != nil {
+		return context.userProfile.Language
+	}
+
+	if b.subscribers != nil {
+		s, e := b.subscribers.Store.Get(context.GetUserId())
+		if e == nil && s != nil && s.Profile != nil {
+			return s.Profile.Language
+		}
+	}
+	return ""
+}
+
+// ReplyOnError makes the bot reply according to replies instead of the queued messages
+// when a handler fails. Errors still go to OnError handlers
+func (b *Bot) ReplyOnError(replies *ErrorReplies) {
+	b.errorReplies = replies
+}
@@ -0,0 +1,105 @@
+package lbotx
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorRepliesMessage(t *testing.T) {
+	errorNotFound := errors.New("not found")
+	replies := NewErrorReplies("en", "Sorry, something went wrong").
+		WithApology("ja", "申し訳ありません").
+		WithApology("zh", "抱歉").
+		WithErrorMessage(errorNotFound, "en", "Nothing found").
+		WithErrorMessage(errorNotFound, "ja", "見つかりません")
+
+	assert.Equal(t, replies.Message("ja", errors.New("db down")), "申し訳ありません")
+	assert.Equal(t, replies.Message("zh-Hant", errors.New("db down")), "抱歉")
+	assert.Equal(t, replies.Message("fr", errors.New("db down")), "Sorry, something went wrong")
+	assert.Equal(t, replies.Message("", errors.New("db down")), "Sorry, something went wrong")
+
+	assert.Equal(t, replies.Message("ja", errorNotFound), "見つかりません")
+	assert.Equal(t, replies.Message("zh", errorNotFound), "Nothing found")
+
+	e := UserErrorWith("Sorry, invalid date", errors.New("parsing time \"2-30\""))
+	assert.Equal(t, replies.Message("ja", e), "Sorry, invalid date")
+	assert.Equal(t, e.Error(), "Sorry, invalid date: parsing time \"2-30\"")
+	assert.Equal(t, UserError("Sorry, invalid date").Error(), "Sorry, invalid date")
+}
+
+func TestReplyOnError(t *testing.T) {
+	replies := []string{}
+	profiles := 0
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.RequestURI, "profile") {
+			profiles++
+			w.WriteHeader(200)
+			w.Write([]byte(`{"userId":"U1","displayName":"BOT API","language":"ja"}`))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(req.Body)
+		replies = append(replies, string(data))
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	defer mockServer.Close()
+
+	bot, _ := NewBot("test", "test")
+	bot.Client, _ = mockClient(mockServer)
+
+	internal := []error{}
+	bot.OnError(func(context *BotContext, err error) {
+		internal = append(internal, err)
+	})
+	bot.ReplyOnError(NewErrorReplies("en", "Sorry, something went wrong").WithApology("ja", "申し訳ありません"))
+
+	bot.OnTextWith("remind me on {{date}}", func(context *BotContext, text string) (bool, error) {
+		context.Messages.AddTextMessage("Got it")
+		return false, UserErrorWith("Sorry, invalid date", errors.New("parsing time "+context.Params["date"]))
+	})
+	bot.OnText(func(context *BotContext, text string) (bool, error) {
+		if text == "hello" {
+			context.GetUser()
+		}
+		context.Messages.AddTextMessage("Working on it")
+		return false, errors.New("db down")
+	})
+
+	user := &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U1"}
+	event := textEvent(user, "remind me on 2-30")
+	event.ReplyToken = "nHuyWiB7yP5Zw52FIkcQobQuGDXCTA"
+	bot.handleEvent(event)
+
+	assert.Equal(t, len(replies), 1)
+	assert.True(t, strings.Contains(replies[0], `"text":"Sorry, invalid date"`))
+	assert.False(t, strings.Contains(replies[0], "Got it"))
+	assert.Equal(t, profiles, 0)
+
+	event.Message = &linebot.TextMessage{ID: "325708", Text: "hello"}
+	bot.handleEvent(event)
+
+	assert.Equal(t, len(replies), 2)
+	assert.True(t, strings.Contains(replies[1], `"text":"申し訳ありません"`))
+	assert.False(t, strings.Contains(replies[1], "db down"))
+	assert.Equal(t, profiles, 1)
+
+	//Profiles aren't fetched for error replies
+	event.Message = &linebot.TextMessage{ID: "325708", Text: "hi"}
+	bot.handleEvent(event)
+
+	assert.Equal(t, len(replies), 3)
+	assert.True(t, strings.Contains(replies[2], `"text":"Sorry, something went wrong"`))
+	assert.Equal(t, profiles, 1)
+
+	assert.Equal(t, len(internal), 3)
+	assert.Equal(t, internal[0].Error(), "Sorry, invalid date: parsing time 2-30")
+	assert.Equal(t, internal[1].Error(), "db down")
+}